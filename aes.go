@@ -0,0 +1,84 @@
+package gofuscator
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"math/rand"
+)
+
+// AES-256 in CBC mode, with the IV in front of the ciphertext
+type aesCBC struct{}
+
+func (aesCBC) Name() string {
+	return "aes-cbc"
+}
+
+func (aesCBC) KeySize() int {
+	return 32
+}
+
+func (aesCBC) Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte {
+	// Padding is always added, a full block of it when the length is a multiple of the
+	// block size, so the last byte always tells how much to remove
+	padding := aes.BlockSize - len(plaintext) % aes.BlockSize
+	ciphertext := make([]byte, aes.BlockSize + len(plaintext) + padding)
+	r.Read(ciphertext[:aes.BlockSize])
+	copy(ciphertext[aes.BlockSize:], plaintext)
+	copy(ciphertext[aes.BlockSize + len(plaintext):], bytes.Repeat([]byte{byte(padding)}, padding))
+
+	block, _ := aes.NewCipher(key)
+	mode := cipher.NewCBCEncrypter(block, ciphertext[:aes.BlockSize])
+	mode.CryptBlocks(ciphertext[aes.BlockSize:], ciphertext[aes.BlockSize:])
+	return ciphertext
+}
+
+func (aesCBC) DecryptFunction(name string) string {
+	return `
+func ` + name + `(ciphertext string, key string) string {
+	plaintext := []byte(ciphertext[aes.BlockSize:])
+	block, _ := aes.NewCipher([]byte(key))
+	mode := cipher.NewCBCDecrypter(block, []byte(ciphertext[:aes.BlockSize]))
+	mode.CryptBlocks(plaintext, plaintext)
+	return string(plaintext[:len(plaintext) - int(plaintext[len(plaintext) - 1])])
+}
+`
+}
+
+func (aesCBC) Imports() []string {
+	return []string{"crypto/aes", "crypto/cipher"}
+}
+
+// AES-256 in GCM mode, with the nonce in front of the ciphertext
+type aesGCM struct{}
+
+func (aesGCM) Name() string {
+	return "aes-gcm"
+}
+
+func (aesGCM) KeySize() int {
+	return 32
+}
+
+func (aesGCM) Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte {
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	r.Read(nonce)
+	return gcm.Seal(nonce, nonce, plaintext, nil)
+}
+
+func (aesGCM) DecryptFunction(name string) string {
+	return `
+func ` + name + `(ciphertext string, key string) string {
+	block, _ := aes.NewCipher([]byte(key))
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, _ := gcm.Open(nil, []byte(ciphertext[:gcm.NonceSize()]), []byte(ciphertext[gcm.NonceSize():]), nil)
+	return string(plaintext)
+}
+`
+}
+
+func (aesGCM) Imports() []string {
+	return []string{"crypto/aes", "crypto/cipher"}
+}
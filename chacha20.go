@@ -0,0 +1,100 @@
+package gofuscator
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"math/rand"
+)
+
+// ChaCha20 as in RFC 8439, with the 12 byte nonce in front of the ciphertext. The
+// decrypt function is generated in full, so no package outside the standard library is needed
+type chaCha20 struct{}
+
+func (chaCha20) Name() string {
+	return "chacha20"
+}
+
+func (chaCha20) KeySize() int {
+	return 32
+}
+
+func (chaCha20) Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte {
+	ciphertext := make([]byte, 12 + len(plaintext))
+	r.Read(ciphertext[:12])
+	copy(ciphertext[12:], plaintext)
+	chaCha20XOR(ciphertext[12:], key, ciphertext[:12])
+	return ciphertext
+}
+
+// Xors the data with the key stream of the key and nonce, the block counter starts at 0
+func chaCha20XOR(data []byte, key []byte, nonce []byte) {
+	var state [16]uint32
+	state[0], state[1], state[2], state[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		state[4 + i] = binary.LittleEndian.Uint32(key[i * 4:])
+	}
+	for i := 0; i < 3; i++ {
+		state[13 + i] = binary.LittleEndian.Uint32(nonce[i * 4:])
+	}
+
+	for offset := 0; offset < len(data); offset += 64 {
+		state[12] = uint32(offset / 64)
+		x := state
+		for round := 0; round < 10; round++ {
+			for _, q := range [8][4]int{{0, 4, 8, 12}, {1, 5, 9, 13}, {2, 6, 10, 14}, {3, 7, 11, 15}, {0, 5, 10, 15}, {1, 6, 11, 12}, {2, 7, 8, 13}, {3, 4, 9, 14}} {
+				x[q[0]] += x[q[1]]
+				x[q[3]] = bits.RotateLeft32(x[q[3]] ^ x[q[0]], 16)
+				x[q[2]] += x[q[3]]
+				x[q[1]] = bits.RotateLeft32(x[q[1]] ^ x[q[2]], 12)
+				x[q[0]] += x[q[1]]
+				x[q[3]] = bits.RotateLeft32(x[q[3]] ^ x[q[0]], 8)
+				x[q[2]] += x[q[3]]
+				x[q[1]] = bits.RotateLeft32(x[q[1]] ^ x[q[2]], 7)
+			}
+		}
+		for i := 0; i < 64 && offset + i < len(data); i++ {
+			data[offset + i] ^= byte((x[i / 4] + state[i / 4]) >> (8 * (i % 4)))
+		}
+	}
+}
+
+func (chaCha20) DecryptFunction(name string) string {
+	return `
+func ` + name + `(ciphertext string, key string) string {
+	var state [16]uint32
+	state[0], state[1], state[2], state[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		state[4 + i] = binary.LittleEndian.Uint32([]byte(key[i * 4:]))
+	}
+	for i := 0; i < 3; i++ {
+		state[13 + i] = binary.LittleEndian.Uint32([]byte(ciphertext[i * 4:]))
+	}
+
+	data := []byte(ciphertext[12:])
+	for offset := 0; offset < len(data); offset += 64 {
+		state[12] = uint32(offset / 64)
+		x := state
+		for round := 0; round < 10; round++ {
+			for _, q := range [8][4]int{{0, 4, 8, 12}, {1, 5, 9, 13}, {2, 6, 10, 14}, {3, 7, 11, 15}, {0, 5, 10, 15}, {1, 6, 11, 12}, {2, 7, 8, 13}, {3, 4, 9, 14}} {
+				x[q[0]] += x[q[1]]
+				x[q[3]] = bits.RotateLeft32(x[q[3]] ^ x[q[0]], 16)
+				x[q[2]] += x[q[3]]
+				x[q[1]] = bits.RotateLeft32(x[q[1]] ^ x[q[2]], 12)
+				x[q[0]] += x[q[1]]
+				x[q[3]] = bits.RotateLeft32(x[q[3]] ^ x[q[0]], 8)
+				x[q[2]] += x[q[3]]
+				x[q[1]] = bits.RotateLeft32(x[q[1]] ^ x[q[2]], 7)
+			}
+		}
+		for i := 0; i < 64 && offset + i < len(data); i++ {
+			data[offset + i] ^= byte((x[i / 4] + state[i / 4]) >> (8 * (i % 4)))
+		}
+	}
+	return string(data)
+}
+`
+}
+
+func (chaCha20) Imports() []string {
+	return []string{"encoding/binary", "math/bits"}
+}
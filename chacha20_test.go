@@ -0,0 +1,33 @@
+package gofuscator
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vector of section 2.4.2 of RFC 8439
+func TestChaCha20RFC8439(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	nonce, _ := hex.DecodeString("000000000000004a00000000")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	expected, _ := hex.DecodeString(
+		"6e2e359a2568f98041ba0728dd0d6981" +
+		"e97e7aec1d4360c20a27afccfd9fae0b" +
+		"f91b65c5524733ab8f593dabcd62b357" +
+		"1639d624e65152ab8f530c359f0861d8" +
+		"07ca0dbf500d6a6156a38e088a22b65e" +
+		"52bc514d16ccf806818ce91ab7793736" +
+		"5af90bbf74a35be6b40b8eedf2785e42" +
+		"874d")
+
+	// The vector starts at block 1, the key stream starts at block 0
+	data := append(make([]byte, 64), plaintext...)
+	chaCha20XOR(data, key, nonce)
+	if (!bytes.Equal(data[64:], expected)) {
+		t.Errorf("ciphertext is\n%x\nexpected\n%x", data[64:], expected)
+	}
+}
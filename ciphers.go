@@ -0,0 +1,319 @@
+package gofuscator
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"go/token"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Cipher is a scheme strings are encrypted with. Strings are encrypted while obfuscating
+// and decrypted at runtime by a function the scheme adds to every package
+type Cipher interface {
+	// Name selects the cipher through Config.Cipher
+	Name() string
+	// Length of the key in bytes, at most 32. Every string is encrypted with a key of its own
+	KeySize() int
+	// Encrypts the plaintext. Nonces and IVs are drawn from r and carried in the ciphertext
+	Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte
+	// Go source of the decrypt function, func name(ciphertext string, key string) string,
+	// along with the helpers it needs, which are named with name as a prefix
+	DecryptFunction(name string) string
+	// Import paths the decrypt function uses
+	Imports() []string
+}
+
+var registered_ciphers = make(map[string]Cipher)
+
+func init() {
+	for _, c := range []Cipher{aesCBC{}, aesGCM{}, chaCha20{}, xorStream{}, rc4Cipher{}, feistel{}} {
+		RegisterCipher(c)
+	}
+}
+
+// RegisterCipher makes a cipher available to Config.Cipher of every run. It panics
+// if a cipher with the same name is already registered
+func RegisterCipher(c Cipher) {
+	if _, exists := registered_ciphers[c.Name()]; exists {
+		panic("gofuscator: cipher " + c.Name() + " registered twice")
+	}
+	registered_ciphers[c.Name()] = c
+}
+
+// Ciphers returns the names of the registered ciphers, sorted
+func Ciphers() []string {
+	var names []string
+	for name := range registered_ciphers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolves Config.Cipher and splits the master secret the keys of the strings are derived
+// from. "random" uses every registered cipher, in the order of their names
+func (o *obfuscator) selectCiphers() error {
+	names := []string{o.config.Cipher}
+	if (o.config.Cipher == "") {
+		names = []string{"aes-cbc"}
+	} else if (o.config.Cipher == "random") {
+		names = Ciphers()
+	}
+
+	for _, name := range names {
+		c, exists := registered_ciphers[name]
+		if (!exists) {
+			return fmt.Errorf("unknown cipher %s", name)
+		}
+		if (c.KeySize() > sha256.Size) {
+			return fmt.Errorf("cipher %s: keys longer than %d bytes are not supported", name, sha256.Size)
+		}
+		o.ciphers = append(o.ciphers, c)
+	}
+
+	// The secret is the xor of its shares, no share tells anything about it on its own
+	o.master_secret = make([]byte, sha256.Size)
+	o.rand.Read(o.master_secret)
+	last_share := append([]byte(nil), o.master_secret...)
+	for i := 0; i < key_shares_amount - 1; i++ {
+		share := make([]byte, sha256.Size)
+		o.rand.Read(share)
+		for j := range share {
+			last_share[j] ^= share[j]
+		}
+		o.key_shares = append(o.key_shares, share)
+	}
+	o.key_shares = append(o.key_shares, last_share)
+	return nil
+}
+
+const key_shares_amount = 4
+
+// Key of the string with the given index, the hash of the master secret and the index
+func (o *obfuscator) deriveKey(index uint64, size int) []byte {
+	var index_bytes [8]byte
+	binary.LittleEndian.PutUint64(index_bytes[:], index)
+	sum := sha256.Sum256(append(append([]byte(nil), o.master_secret...), index_bytes[:]...))
+	return sum[:size]
+}
+
+// Cipher to encrypt the next string with
+func (o *obfuscator) pickCipher() Cipher {
+	if (len(o.ciphers) == 1) {
+		return o.ciphers[0]
+	}
+	return o.ciphers[o.rand.Intn(len(o.ciphers))]
+}
+
+// Name of the decrypt function of a cipher, "aes-cbc" gets aesCbcDecrypt
+func decryptName(c Cipher) string {
+	decrypt_name := ""
+	words := strings.FieldsFunc(strings.ToLower(c.Name()), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if (i > 0) {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		decrypt_name = decrypt_name + word
+	}
+	return decrypt_name + "Decrypt"
+}
+
+// Whether the string is one of the shares of the master secret, which are left unencrypted
+func (o *obfuscator) isKeyShare(value string) bool {
+	for _, share := range o.key_shares {
+		if (string(share) == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds the shares of the master secret, spread over the unconstrained files of the package, along with
+// the key derivation and the decrypt function of every cipher the strings can be encrypted with
+func (o *obfuscator) addCiphers(pkg *Package) error {
+	if (o.config.NoStringsEncryption) {
+		return nil
+	}
+
+	// Shares only go to the files built along with the first one, which hosts the key derivation
+	hosts := []int{0}
+	for i := 1; i < len(pkg.Files); i++ {
+		if (!hasBuildConstraints(pkg.file_names[i], pkg.Files[i])) {
+			hosts = append(hosts, i)
+		}
+	}
+	var share_names []string
+	for i, share := range o.key_shares {
+		share_name := "key_share_obf_" + strconv.Itoa(i)
+		host := hosts[i % len(hosts)]
+		pkg.Files[host] = addGlobalVar(pkg.Files[host], share_name, "string", token.STRING, strconv.Quote(string(share)))
+		share_names = append(share_names, share_name)
+	}
+	err := addDeclarations(pkg.Files[0], pkg.Fset, `
+func deriveKey(index uint64, size int) string {
+	secret := make([]byte, 32, 40)
+	for _, share := range []string{` + strings.Join(share_names, ", ") + `} {
+		for i := range secret {
+			secret[i] ^= share[i]
+		}
+	}
+	var index_bytes [8]byte
+	binary.LittleEndian.PutUint64(index_bytes[:], index)
+	sum := sha256.Sum256(append(secret, index_bytes[:]...))
+	return string(sum[:size])
+}
+`)
+	if err != nil {
+		return fmt.Errorf("adding key derivation: %w", err)
+	}
+	pkg.addImport(pkg.Files[0], "crypto/sha256")
+	pkg.addImport(pkg.Files[0], "encoding/binary")
+
+	for _, c := range o.ciphers {
+		err = addDeclarations(pkg.Files[0], pkg.Fset, c.DecryptFunction(decryptName(c)))
+		if err != nil {
+			return fmt.Errorf("adding decrypt function of cipher %s: %w", c.Name(), err)
+		}
+		for _, import_path := range c.Imports() {
+			pkg.addImport(pkg.Files[0], import_path)
+		}
+	}
+	return nil
+}
+
+// Name a helper added by the tool has after the rename pass
+func (o *obfuscator) helperName(pkg *Package, name string) string {
+	if obj := pkg.Types.Scope().Lookup(name); obj != nil {
+		return o.renamedObjectName(obj)
+	}
+	return name
+}
+
+// Encrypts the string with one of the ciphers, into a call of its decrypt function. Every
+// string gets a key of its own, derived at runtime from the index of the string
+func (o *obfuscator) encryptString(pkg *Package, value string) string {
+	c := o.pickCipher()
+	index := o.strings_encrypted
+	o.strings_encrypted++
+	ciphertext := c.Encrypt([]byte(value), o.deriveKey(index, c.KeySize()), o.rand)
+	key := o.helperName(pkg, "deriveKey") + "(" + strconv.FormatUint(index, 10) + ", " + strconv.Itoa(c.KeySize()) + ")"
+	return o.helperName(pkg, decryptName(c)) + "(" + o.obfuscateString(string(ciphertext)) + ", " + key + ")"
+}
+
+// Key stream of xorshift64 seeded with the first 8 bytes of the key, mixed with the key itself
+type xorStream struct{}
+
+func (xorStream) Name() string {
+	return "xor"
+}
+
+func (xorStream) KeySize() int {
+	return 32
+}
+
+func (xorStream) Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte {
+	ciphertext := make([]byte, len(plaintext))
+	// xorshift gets stuck at a zero state
+	state := binary.LittleEndian.Uint64(key) | 1
+	for i := range plaintext {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		ciphertext[i] = plaintext[i] ^ byte(state) ^ key[i % len(key)]
+	}
+	return ciphertext
+}
+
+func (xorStream) DecryptFunction(name string) string {
+	return `
+func ` + name + `(ciphertext string, key string) string {
+	plaintext := make([]byte, len(ciphertext))
+	state := binary.LittleEndian.Uint64([]byte(key)) | 1
+	for i := 0; i < len(ciphertext); i++ {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		plaintext[i] = ciphertext[i] ^ byte(state) ^ key[i % len(key)]
+	}
+	return string(plaintext)
+}
+`
+}
+
+func (xorStream) Imports() []string {
+	return []string{"encoding/binary"}
+}
+
+// RC4 with the first 256 bytes of the key stream dropped
+type rc4Cipher struct{}
+
+func (rc4Cipher) Name() string {
+	return "rc4"
+}
+
+func (rc4Cipher) KeySize() int {
+	return 16
+}
+
+func (rc4Cipher) Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte {
+	var s [256]byte
+	for i := range s {
+		s[i] = byte(i)
+	}
+	j := byte(0)
+	for i := range s {
+		j += s[i] + key[i % len(key)]
+		s[i], s[j] = s[j], s[i]
+	}
+
+	ciphertext := make([]byte, len(plaintext))
+	x, y := byte(0), byte(0)
+	for i := 0; i < 256 + len(plaintext); i++ {
+		x++
+		y += s[x]
+		s[x], s[y] = s[y], s[x]
+		if (i >= 256) {
+			ciphertext[i - 256] = plaintext[i - 256] ^ s[s[x] + s[y]]
+		}
+	}
+	return ciphertext
+}
+
+func (rc4Cipher) DecryptFunction(name string) string {
+	return `
+func ` + name + `(ciphertext string, key string) string {
+	var s [256]byte
+	for i := range s {
+		s[i] = byte(i)
+	}
+	j := byte(0)
+	for i := range s {
+		j += s[i] + key[i % len(key)]
+		s[i], s[j] = s[j], s[i]
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	x, y := byte(0), byte(0)
+	for i := 0; i < 256 + len(ciphertext); i++ {
+		x++
+		y += s[x]
+		s[x], s[y] = s[y], s[x]
+		if i >= 256 {
+			plaintext[i - 256] = ciphertext[i - 256] ^ s[s[x] + s[y]]
+		}
+	}
+	return string(plaintext)
+}
+`
+}
+
+func (rc4Cipher) Imports() []string {
+	return nil
+}
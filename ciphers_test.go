@@ -0,0 +1,82 @@
+package gofuscator
+
+import (
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var round_trip_plaintexts = []string{
+	"",
+	"a",
+	"hello, world",
+	"exactly 16 bytes",
+	"seventeen bytes..",
+	strings.Repeat("block boundary ", 9),
+	"юникод 😀 文字",
+	"\x00\xff\n\"quoted\"",
+}
+
+// Encrypts with every registered cipher and runs the generated decrypt function on the results
+func TestCipherRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not found")
+	}
+
+	for _, name := range Ciphers() {
+		c := registered_ciphers[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r := rand.New(rand.NewSource(1))
+
+			imports := []string{"fmt"}
+			for _, import_path := range c.Imports() {
+				if (import_path != "fmt") {
+					imports = append(imports, import_path)
+				}
+			}
+			source := "package main\n\nimport (\n"
+			for _, import_path := range imports {
+				source += "\t" + strconv.Quote(import_path) + "\n"
+			}
+			source += ")\n" + c.DecryptFunction("decrypt") + "\nfunc main() {\n"
+
+			var expected []string
+			for _, plaintext := range round_trip_plaintexts {
+				key := make([]byte, c.KeySize())
+				r.Read(key)
+				ciphertext := c.Encrypt([]byte(plaintext), key, r)
+				source += "\tfmt.Println(strconv.Quote(decrypt(" + strconv.Quote(string(ciphertext)) + ", " + strconv.Quote(string(key)) + ")))\n"
+				expected = append(expected, strconv.Quote(plaintext))
+			}
+			source += "}\n"
+			if (!strings.Contains(source, "\t\"strconv\"\n")) {
+				source = strings.Replace(source, "import (\n", "import (\n\t\"strconv\"\n", 1)
+			}
+
+			program := filepath.Join(t.TempDir(), "main.go")
+			err := os.WriteFile(program, []byte(source), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := exec.Command("go", "run", program).CombinedOutput()
+			if err != nil {
+				t.Fatalf("running the decrypt function: %v\n%s", err, output)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+			if (len(lines) != len(expected)) {
+				t.Fatalf("expected %d plaintexts, got:\n%s", len(expected), output)
+			}
+			for i := range expected {
+				if (lines[i] != expected[i]) {
+					t.Errorf("decrypted %s, expected %s", lines[i], expected[i])
+				}
+			}
+		})
+	}
+}
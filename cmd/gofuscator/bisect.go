@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/artemixer/gofuscator"
+)
+
+// Narrows the changes of the run down to the fewest that still make the -bisect command fail
+func bisect(config gofuscator.Config) {
+	if (*input_file == "-" || *output_file == "-") {
+		fmt.Println("Bisecting needs the input and the output on disk")
+		os.Exit(1)
+	}
+
+	// The command fails the output with a non zero exit code
+	test := func() (bool, error) {
+		cmd := exec.Command("sh", "-c", *bisect_command)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		var exit_error *exec.ExitError
+		if (errors.As(err, &exit_error)) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	entries, err := gofuscator.Bisect(*input_file, *output_file, config, test)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d changes make the test fail, %s holds their output:\n", len(entries), *output_file)
+	for _, entry := range entries {
+		fmt.Printf("%s %s: %s -> %s\n", entry.Pass, entry.Position, entry.Old, entry.New)
+	}
+}
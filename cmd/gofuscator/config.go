@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/artemixer/gofuscator"
+)
+
+// Registers the flags configuring the obfuscation on flags, shared by the main command and verify.
+// The returned function builds the config once the flags are parsed
+func configFlags(flags *flag.FlagSet) func() gofuscator.Config {
+	ignore_verify_bool := flags.Bool("no-verify", false, "disables type checking after every pass, which reverts changes that break compilation")
+	line_directives_bool := flags.Bool("line-directives", false, "keeps the original line numbers in stack traces, under obfuscated file names")
+
+	ignore_ints_bool := flags.Bool("no-ints", false, "disables int/float obfuscation")
+	ignore_strings_obfuscation_bool := flags.Bool("no-strings-obf", false, "disables string obfuscation")
+	ignore_strings_encryption_bool := flags.Bool("no-strings-enc", false, "disables string encryption")
+	ignore_vars_bool := flags.Bool("no-vars", false, "disables variable name obfuscation")
+	ignore_functions_bool := flags.Bool("no-functions", false, "disables function name/call obfuscation")
+	ignore_methods_bool := flags.Bool("no-methods", false, "disables method name obfuscation")
+	ignore_types_bool := flags.Bool("no-types", false, "disables type name obfuscation")
+	ignore_fields_bool := flags.Bool("no-fields", false, "disables struct field name obfuscation")
+	ignore_bools_bool := flags.Bool("no-bools", false, "disables bool obfuscation")
+	ignore_hexes_bool := flags.Bool("no-hexes", false, "disables hex value obfuscation")
+	ignore_imports_bool := flags.Bool("no-imports", false, "disables import obfuscation")
+	cipher := flags.String("cipher", "", "scheme strings are encrypted with, one of " + strings.Join(gofuscator.Ciphers(), ", ") + " or random, defaults to aes-cbc")
+	obfuscate_exported_bool := flags.Bool("exported", false, "also obfuscates exported identifiers when processing a module")
+	passes := flags.String("passes", "", "comma separated list of passes to run, defaults to " + strings.Join(gofuscator.DefaultPasses(), ","))
+	disabled_passes := flags.String("disable-passes", "", "comma separated list of passes to leave out")
+
+	return func() gofuscator.Config {
+		config := gofuscator.Config{
+			NoInts: *ignore_ints_bool,
+			NoStringsObfuscation: *ignore_strings_obfuscation_bool,
+			NoStringsEncryption: *ignore_strings_encryption_bool,
+			NoVars: *ignore_vars_bool,
+			NoFunctions: *ignore_functions_bool,
+			NoMethods: *ignore_methods_bool,
+			NoTypes: *ignore_types_bool,
+			NoFields: *ignore_fields_bool,
+			NoBools: *ignore_bools_bool,
+			NoHexes: *ignore_hexes_bool,
+			NoImports: *ignore_imports_bool,
+			Cipher: *cipher,
+			Exported: *obfuscate_exported_bool,
+			NoVerify: *ignore_verify_bool,
+			LineDirectives: *line_directives_bool,
+		}
+		if (len(*passes) > 0) {
+			config.Passes = strings.Split(*passes, ",")
+		}
+		if (len(*disabled_passes) > 0) {
+			config.DisabledPasses = strings.Split(*disabled_passes, ",")
+		}
+		return config
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/artemixer/gofuscator"
+)
+
+var input_file = flag.String("i", "", "the path to the input file or package directory, '-' reads a file from stdin")
+var output_file = flag.String("o", "", "the path to the output file or directory, '-' writes a file to stdout")
+var seed = flag.String("seed", "", "seed to use for code generation")
+var map_file = flag.String("map", "", "the path to write the obfuscation map of every renamed identifier to")
+var reuse_map_file = flag.String("reuse-map", "", "the path to the obfuscation map of a previous build, its symbols keep their names")
+var journal_file = flag.String("journal", "", "the path to write the journal of every change made to")
+var replay_file = flag.String("replay", "", "the path to a journal to replay, only its changes are made, with its seed")
+var bisect_command = flag.String("bisect", "", "shell command testing the output, looks for the fewest changes that still make it fail")
+
+var build_config = configFlags(flag.CommandLine)
+
+func main() {
+	if (len(os.Args) > 1 && os.Args[1] == "symbolize") {
+		symbolize(os.Args[2:])
+		return
+	}
+	if (len(os.Args) > 1 && os.Args[1] == "verify") {
+		verify(os.Args[2:])
+		return
+	}
+
+	flag.Parse()
+	if (len(*input_file) < 1) {
+		fmt.Println("Please provide an input file or package directory with '--i'")
+		os.Exit(1)
+	}
+	if (len(*output_file) < 1) {
+		fmt.Println("Please provide an output file or directory with '--o'")
+		os.Exit(1)
+	}
+
+	config := build_config()
+	config.Seed = *seed
+	config.MapFile = *map_file
+	config.ReuseMapFile = *reuse_map_file
+	config.JournalFile = *journal_file
+	config.Log = os.Stdout
+	// Stdout is kept for the obfuscated source
+	if (*output_file == "-") {
+		config.Log = os.Stderr
+	}
+	if (len(*replay_file) > 0) {
+		journal, err := gofuscator.ReadJournal(*replay_file)
+		if err != nil {
+			fmt.Fprintln(config.Log, "Error:", err)
+			os.Exit(1)
+		}
+		config.Replay = journal
+	}
+
+	if (len(*bisect_command) > 0) {
+		bisect(config)
+		return
+	}
+
+	if (*input_file == "-" || *output_file == "-") {
+		var source []byte
+		var err error
+		if (*input_file == "-") {
+			source, err = io.ReadAll(os.Stdin)
+		} else {
+			source, err = os.ReadFile(*input_file)
+		}
+		if err != nil {
+			fmt.Fprintln(config.Log, "Error reading input:", err)
+			os.Exit(1)
+		}
+
+		output, err := gofuscator.Obfuscate(source, config)
+		if err == nil && *output_file == "-" {
+			_, err = os.Stdout.Write(output)
+		} else if err == nil {
+			err = os.WriteFile(*output_file, output, 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(config.Log, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	input_info, err := os.Stat(*input_file)
+	if err != nil {
+		fmt.Println("Error reading input:", err)
+		os.Exit(1)
+	}
+
+	if (input_info.IsDir()) {
+		err = gofuscator.ObfuscateDir(*input_file, *output_file, config)
+	} else {
+		err = gofuscator.ObfuscateFile(*input_file, *output_file, config)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
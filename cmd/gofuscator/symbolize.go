@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/artemixer/gofuscator"
+)
+
+// Reads a stack trace from stdin or -i and prints it with the original names
+func symbolize(args []string) {
+	flags := flag.NewFlagSet("symbolize", flag.ExitOnError)
+	map_file := flags.String("map", "", "the path to the obfuscation map written with -map")
+	input_file := flags.String("i", "", "the path to the stack trace, read from stdin when empty")
+	flags.Parse(args)
+
+	if (len(*map_file) < 1) {
+		fmt.Println("Please provide the obfuscation map with '--map'")
+		os.Exit(1)
+	}
+
+	mapping, err := gofuscator.ReadMapping(*map_file)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	var input io.Reader = os.Stdin
+	if (len(*input_file) > 0) {
+		file, err := os.Open(*input_file)
+		if err != nil {
+			fmt.Println("Error reading input:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	err = gofuscator.Symbolize(input, os.Stdout, mapping)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/artemixer/gofuscator"
+)
+
+// Obfuscates the program with several seeds and compares every run of it to the original
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	input_file := flags.String("i", "", "the path to the program file, package directory or module to verify")
+	seed := flags.String("seed", "", "seed the seeds of the runs are derived from, '1' to 'n' when empty")
+	seed_count := flags.Int("n", 5, "number of seeds to obfuscate the program with")
+	stdin_file := flags.String("stdin", "", "the path to a file passed as stdin to every run, '-' passes stdin")
+	timeout := flags.Duration("timeout", 30 * time.Second, "time a single run of a program may take")
+	build_config := configFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gofuscator verify -i <program> [flags] [-- program arguments]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if (len(*input_file) < 1) {
+		fmt.Println("Please provide the program to verify with '--i'")
+		os.Exit(1)
+	}
+
+	options := gofuscator.ExecutionOptions{
+		Config: build_config(),
+		Args: flags.Args(),
+		Timeout: *timeout,
+		Log: os.Stdout,
+	}
+	for i := 1; i <= *seed_count; i++ {
+		if (len(*seed) > 0) {
+			options.Seeds = append(options.Seeds, *seed + "-" + strconv.Itoa(i))
+		} else {
+			options.Seeds = append(options.Seeds, strconv.Itoa(i))
+		}
+	}
+
+	var err error
+	if (*stdin_file == "-") {
+		options.Stdin, err = io.ReadAll(os.Stdin)
+	} else if (len(*stdin_file) > 0) {
+		options.Stdin, err = os.ReadFile(*stdin_file)
+	}
+	if err != nil {
+		fmt.Println("Error reading stdin:", err)
+		os.Exit(1)
+	}
+
+	divergences, err := gofuscator.VerifyExecution(*input_file, options)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if (len(divergences) > 0) {
+		fmt.Printf("%d of %d seeds diverged from the original\n", len(divergences), len(options.Seeds))
+		os.Exit(1)
+	}
+	fmt.Printf("All %d seeds match the original\n", len(options.Seeds))
+}
@@ -0,0 +1,108 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Const declarations that can become var declarations. A declaration stays constant if it
+// relies on iota or implicit repetition, or if any of its constants is used where a variable
+// would not compile or would behave differently
+func (o *obfuscator) variableConsts(pkg *Package) map[*ast.GenDecl]bool {
+	// Packages the current one imports are already obfuscated, their constants are checked as they were
+	o.checkLiteralTypes(pkg, o.moduleImporter())
+	info := pkg.Info
+
+	uses := make(map[types.Object]int)
+	required := make(map[types.Object]bool)
+	for _, file := range pkg.Files {
+		parents := parentNodes(file)
+		ast.Inspect(file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if (!ok) {
+				return true
+			}
+			if obj, is_const := info.Uses[ident].(*types.Const); is_const && obj.Pkg() == pkg.Types {
+				uses[obj]++
+				if (!toleratesVariable(info, parents, ident, obj)) {
+					required[obj] = true
+				}
+			}
+			return true
+		})
+	}
+
+	variable_decls := make(map[*ast.GenDecl]bool)
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			decl, ok := n.(*ast.GenDecl)
+			if (!ok || decl.Tok != token.CONST) {
+				return true
+			}
+
+			variable := true
+			for _, spec := range decl.Specs {
+				value_spec := spec.(*ast.ValueSpec)
+				if (len(value_spec.Values) == 0 || usesIota(info, value_spec)) {
+					variable = false
+				}
+				for _, name := range value_spec.Names {
+					obj, is_const := info.Defs[name].(*types.Const)
+					switch {
+					case !is_const, required[obj]:
+						variable = false
+					// Other packages of the module are obfuscated later, their uses are not known yet
+					case o.current_package != "" && obj.Exported() && obj.Parent() == pkg.Types.Scope():
+						variable = false
+					// Unlike constants, local variables have to be used
+					case obj.Parent() != pkg.Types.Scope() && uses[obj] == 0 && name.Name != "_":
+						variable = false
+					}
+				}
+			}
+			variable_decls[decl] = variable
+			return false
+		})
+	}
+	return variable_decls
+}
+
+// Whether the use of the constant would behave the same if it was a variable of its default type
+func toleratesVariable(info *types.Info, parents map[ast.Node]ast.Node, ident *ast.Ident, obj *types.Const) bool {
+	if (requiresConstant(info, parents, ident)) {
+		return false
+	}
+
+	// Numeric constant expressions are evaluated exactly, variables overflow and truncate
+	parent := parents[ident]
+	for {
+		paren, is_paren := parent.(*ast.ParenExpr)
+		if (!is_paren) {
+			break
+		}
+		parent = parents[paren]
+	}
+	if expr, is_expr := parent.(ast.Expr); is_expr && info.Types[expr].Value != nil {
+		if basic, is_basic := obj.Type().Underlying().(*types.Basic); is_basic && basic.Info() & types.IsNumeric != 0 {
+			return false
+		}
+	}
+
+	// Untyped constants take the type of their context, a variable keeps its own
+	t := info.Types[ident].Type
+	return t != nil && types.Identical(types.Default(t), types.Default(obj.Type()))
+}
+
+func usesIota(info *types.Info, spec *ast.ValueSpec) bool {
+	found := false
+	for _, value := range spec.Values {
+		ast.Inspect(value, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && info.Uses[ident] == types.Universe.Lookup("iota") {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
@@ -0,0 +1,126 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+const consts_source = `package main
+
+import "fmt"
+
+const greeting = "hi"
+
+const (
+	first = iota
+	second
+)
+
+const size = 4
+
+var table [size]int
+
+const shift = 3
+
+var mask int64 = 1 << shift
+
+const limit int8 = 5
+
+var small int8 = limit
+
+const ratio = 2
+
+var scale float64 = ratio
+
+const mode uint8 = 7
+
+const huge = 1 << 40
+
+var folded = huge >> 38
+
+const (
+	left = "l"
+	right = left + "r"
+)
+
+const Exported = "e"
+
+func main() {
+	const unused = 1
+	const counted = 2
+	fmt.Println(greeting, first, second, table, mask, small, scale, mode, folded, right, Exported, counted)
+}
+`
+
+// Whether the const declaration holding each constant can become a var declaration
+func TestVariableConsts(t *testing.T) {
+	tests := []struct {
+		name string
+		variable bool
+		module bool
+	}{
+		{"greeting", true, false},
+		// iota and implicit repetition only work in constant declarations
+		{"first", false, false},
+		{"second", false, false},
+		// Array lengths have to be constant
+		{"size", false, false},
+		// Constant shifts are folded exactly
+		{"shift", false, false},
+		// Typed constants used as their type
+		{"limit", true, false},
+		{"mode", true, false},
+		// An untyped int assigned to a float64 takes the type of its context
+		{"ratio", false, false},
+		// Constant expressions are evaluated exactly, 1 << 40 would overflow an int32
+		{"huge", false, false},
+		// Constants referring to other constants in the same declaration
+		{"left", false, false},
+		{"right", false, false},
+		// Exported constants of module packages may be used by packages obfuscated later
+		{"Exported", true, false},
+		{"Exported", false, true},
+		// Unlike constants, local variables have to be used
+		{"unused", false, false},
+		{"counted", true, false},
+	}
+
+	for _, test := range tests {
+		o, err := newObfuscator(Config{Seed: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.current_path = "main"
+		if (test.module) {
+			o.current_package = "example.com/m"
+		}
+
+		files, fset, err := parseSources([]string{"main.go"}, [][]byte{[]byte(consts_source)}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := &Package{Files: files, Fset: fset, o: o, file_names: []string{"main.go"}}
+		variable_decls := o.variableConsts(pkg)
+
+		var decl *ast.GenDecl
+		ast.Inspect(files[0], func(n ast.Node) bool {
+			if genDecl, ok := n.(*ast.GenDecl); ok && genDecl.Tok == token.CONST {
+				for _, spec := range genDecl.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						if (name.Name == test.name) {
+							decl = genDecl
+						}
+					}
+				}
+			}
+			return decl == nil
+		})
+		if (decl == nil) {
+			t.Fatalf("no declaration of %s", test.name)
+		}
+		if (variable_decls[decl] != test.variable) {
+			t.Errorf("%s (module %v): variable is %v, expected %v", test.name, test.module, variable_decls[decl], test.variable)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package gofuscator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExecutionOptions selects how the original and obfuscated programs are run by VerifyExecution
+type ExecutionOptions struct {
+	// Configuration of the obfuscation, Seed is replaced by each of Seeds and no map is written
+	Config Config
+	// Every seed is obfuscated, built and run once
+	Seeds []string
+	// Arguments and stdin passed to every run of both programs
+	Args []string
+	Stdin []byte
+	// Time a single run may take, no limit when zero
+	Timeout time.Duration
+	// Receives the progress of every seed, nothing is logged when nil
+	Log io.Writer
+}
+
+// Divergence is a seed whose obfuscated program behaves differently than the original
+type Divergence struct {
+	Seed string
+	// First pass of the pipeline after which the program diverges, empty if it could not be found
+	Pass string
+	// One of stdout, stderr, exit code, obfuscation or build
+	Output string
+	Original string
+	Obfuscated string
+}
+
+func (d Divergence) String() string {
+	description := "seed " + d.Seed
+	if (d.Pass != "") {
+		description += ", pass " + d.Pass
+	}
+	switch d.Output {
+	case "obfuscation", "build":
+		return description + ": " + d.Output + " failed, " + d.Obfuscated
+	case "exit code":
+		return description + ": exit code " + d.Original + " became " + d.Obfuscated
+	}
+
+	// Only the first differing line is shown
+	original_lines := strings.Split(d.Original, "\n")
+	obfuscated_lines := strings.Split(d.Obfuscated, "\n")
+	for i := 0; i < len(original_lines) || i < len(obfuscated_lines); i++ {
+		original_line, obfuscated_line := "", ""
+		if (i < len(original_lines)) {
+			original_line = original_lines[i]
+		}
+		if (i < len(obfuscated_lines)) {
+			obfuscated_line = obfuscated_lines[i]
+		}
+		if (original_line != obfuscated_line) {
+			return fmt.Sprintf("%s: %s differs at line %d, %q became %q", description, d.Output, i + 1, original_line, obfuscated_line)
+		}
+	}
+	return description + ": " + d.Output + " differs"
+}
+
+// Output of a single run of a program
+type execution struct {
+	stdout string
+	stderr string
+	exit_code int
+}
+
+// VerifyExecution builds the program at input_path, a file, a package directory or a module
+// with its main package at the root, and the obfuscated program of every seed. Both are run
+// with the same arguments and stdin, and every seed whose stdout, stderr or exit code differ
+// is returned, along with the first pass of the pipeline it diverges after
+func VerifyExecution(input_path string, options ExecutionOptions) ([]Divergence, error) {
+	temp_dir, err := os.MkdirTemp("", "gofuscator-verify")
+	if err != nil {
+		return nil, fmt.Errorf("creating build directory: %w", err)
+	}
+	defer os.RemoveAll(temp_dir)
+
+	original_binary := filepath.Join(temp_dir, "original")
+	err = buildProgram(input_path, original_binary)
+	if err != nil {
+		return nil, fmt.Errorf("building original program: %w", err)
+	}
+	original, err := runProgram(original_binary, options)
+	if err != nil {
+		return nil, fmt.Errorf("running original program: %w", err)
+	}
+
+	// Passes the prefixes of the pipeline are taken from when looking for the diverging pass
+	o, err := newObfuscator(options.Config)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := o.buildPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	var divergences []Divergence
+	for i, seed := range options.Seeds {
+		config := options.Config
+		config.Seed = seed
+		divergence := compareProgram(input_path, filepath.Join(temp_dir, fmt.Sprint("seed", i)), config, options, original)
+		if (divergence == nil) {
+			logExecution(options, "seed " + seed + " matches the original")
+			continue
+		}
+
+		// The same seed makes the same decisions in every prefix of the pipeline, the first
+		// prefix that diverges ends with the pass responsible
+		for j := range pipeline {
+			config.Passes = nil
+			for _, t := range pipeline[:j + 1] {
+				config.Passes = append(config.Passes, t.Name())
+			}
+			if prefix_divergence := compareProgram(input_path, filepath.Join(temp_dir, fmt.Sprint("seed", i, "-", j)), config, options, original); prefix_divergence != nil {
+				divergence = prefix_divergence
+				divergence.Pass = pipeline[j].Name()
+				break
+			}
+		}
+		logExecution(options, divergence.String())
+		divergences = append(divergences, *divergence)
+	}
+	return divergences, nil
+}
+
+// Obfuscates, builds and runs the program into output_dir and compares it to the original run
+func compareProgram(input_path string, output_dir string, config Config, options ExecutionOptions, original execution) *Divergence {
+	config.MapFile = ""
+	config.Log = nil
+	failure := func(output string, err error) *Divergence {
+		return &Divergence{Seed: config.Seed, Output: output, Obfuscated: err.Error()}
+	}
+
+	err := os.MkdirAll(output_dir, 0755)
+	if err != nil {
+		return failure("obfuscation", err)
+	}
+	output_path := output_dir
+	if input_info, stat_err := os.Stat(input_path); stat_err == nil && !input_info.IsDir() {
+		output_path = filepath.Join(output_dir, filepath.Base(input_path))
+	}
+	_, err = obfuscatePath(input_path, output_path, config)
+	if err != nil {
+		return failure("obfuscation", err)
+	}
+
+	binary := filepath.Join(output_dir, "obfuscated")
+	err = buildProgram(output_path, binary)
+	if err != nil {
+		return failure("build", err)
+	}
+	obfuscated, err := runProgram(binary, options)
+	if err != nil {
+		return failure("build", err)
+	}
+
+	divergence := &Divergence{Seed: config.Seed}
+	switch {
+	case original.stdout != obfuscated.stdout:
+		divergence.Output, divergence.Original, divergence.Obfuscated = "stdout", original.stdout, obfuscated.stdout
+	case original.stderr != obfuscated.stderr:
+		divergence.Output, divergence.Original, divergence.Obfuscated = "stderr", original.stderr, obfuscated.stderr
+	case original.exit_code != obfuscated.exit_code:
+		divergence.Output, divergence.Original, divergence.Obfuscated = "exit code", fmt.Sprint(original.exit_code), fmt.Sprint(obfuscated.exit_code)
+	default:
+		return nil
+	}
+	return divergence
+}
+
+// Builds a single file, a module with its main package at the root, or the files of a package directory
+func buildProgram(path string, binary string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	targets := []string{path}
+	if (info.IsDir()) {
+		dir = path
+		targets = []string{"."}
+		if _, stat_err := os.Stat(filepath.Join(path, "go.mod")); stat_err != nil {
+			// Outside of a module, the files are built on their own
+			targets, _ = filepath.Glob(filepath.Join(path, "*.go"))
+			for i := 0; i < len(targets); i++ {
+				if (strings.HasSuffix(targets[i], "_test.go")) {
+					targets = append(targets[:i], targets[i + 1:]...)
+					i--
+				}
+			}
+		}
+	}
+
+	cmd := exec.Command("go", append([]string{"build", "-o", binary}, targets...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, output)
+	}
+	return nil
+}
+
+func runProgram(binary string, options ExecutionOptions) (execution, error) {
+	ctx := context.Background()
+	if (options.Timeout > 0) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, options.Args...)
+	cmd.Stdin = bytes.NewReader(options.Stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if (ctx.Err() != nil) {
+		return execution{}, fmt.Errorf("timed out after %s", options.Timeout)
+	}
+
+	// A non zero exit code is part of the behavior being compared
+	var exit_error *exec.ExitError
+	if (errors.As(err, &exit_error)) {
+		err = nil
+	}
+	if err != nil {
+		return execution{}, err
+	}
+	return execution{stdout: stdout.String(), stderr: stderr.String(), exit_code: cmd.ProcessState.ExitCode()}, nil
+}
+
+func logExecution(options ExecutionOptions, message string) {
+	if (options.Log != nil) {
+		fmt.Fprintln(options.Log, message)
+	}
+}
@@ -0,0 +1,71 @@
+package gofuscator
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"math/rand"
+)
+
+// 16 round Feistel network over 64 bit blocks in CBC mode, with the IV in front of the
+// ciphertext. The round keys are the 8 words of the key
+type feistel struct{}
+
+func (feistel) Name() string {
+	return "feistel"
+}
+
+func (feistel) KeySize() int {
+	return 32
+}
+
+func feistelRound(x uint32, key []byte, round int) uint32 {
+	return bits.RotateLeft32(x * 0x9E3779B1 ^ binary.LittleEndian.Uint32(key[round % 8 * 4:]), 5) + uint32(round)
+}
+
+func (feistel) Encrypt(plaintext []byte, key []byte, r *rand.Rand) []byte {
+	padding := 8 - len(plaintext) % 8
+	ciphertext := make([]byte, 8 + len(plaintext) + padding)
+	r.Read(ciphertext[:8])
+	copy(ciphertext[8:], plaintext)
+	for i := 8 + len(plaintext); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(padding)
+	}
+
+	// Every block is xored with the previous block of ciphertext before it is encrypted
+	for offset := 8; offset < len(ciphertext); offset += 8 {
+		left := binary.LittleEndian.Uint32(ciphertext[offset:]) ^ binary.LittleEndian.Uint32(ciphertext[offset - 8:])
+		right := binary.LittleEndian.Uint32(ciphertext[offset + 4:]) ^ binary.LittleEndian.Uint32(ciphertext[offset - 4:])
+		for round := 0; round < 16; round++ {
+			left, right = right, left ^ feistelRound(right, key, round)
+		}
+		binary.LittleEndian.PutUint32(ciphertext[offset:], left)
+		binary.LittleEndian.PutUint32(ciphertext[offset + 4:], right)
+	}
+	return ciphertext
+}
+
+func (feistel) DecryptFunction(name string) string {
+	return `
+func ` + name + `Round(x uint32, key string, round int) uint32 {
+	return bits.RotateLeft32(x * 0x9E3779B1 ^ binary.LittleEndian.Uint32([]byte(key[round % 8 * 4:])), 5) + uint32(round)
+}
+
+func ` + name + `(ciphertext string, key string) string {
+	plaintext := make([]byte, len(ciphertext) - 8)
+	for offset := 8; offset < len(ciphertext); offset += 8 {
+		left := binary.LittleEndian.Uint32([]byte(ciphertext[offset:]))
+		right := binary.LittleEndian.Uint32([]byte(ciphertext[offset + 4:]))
+		for round := 15; round >= 0; round-- {
+			left, right = right ^ ` + name + `Round(left, key, round), left
+		}
+		binary.LittleEndian.PutUint32(plaintext[offset - 8:], left ^ binary.LittleEndian.Uint32([]byte(ciphertext[offset - 8:])))
+		binary.LittleEndian.PutUint32(plaintext[offset - 4:], right ^ binary.LittleEndian.Uint32([]byte(ciphertext[offset - 4:])))
+	}
+	return string(plaintext[:len(plaintext) - int(plaintext[len(plaintext) - 1])])
+}
+`
+}
+
+func (feistel) Imports() []string {
+	return []string{"encoding/binary", "math/bits"}
+}
@@ -0,0 +1,319 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Packages that look fields up by name at runtime. Type names are only kept for
+// the ones that write them out
+var encoding_packages = map[string]bool{
+	"encoding/json": false,
+	"encoding/xml": true,
+	"encoding/gob": true,
+	"reflect": true,
+}
+
+// Keeps the names of fields and types that are looked up by name at runtime: fields with
+// struct tags, and everything reachable from values passed to encoders or reflection.
+// Values converted to an empty interface or used as type arguments can reach an encoder
+// through a wrapper, their exported fields are kept as well.
+// Fields of identical struct types are linked, as conversions between them need matching names
+func (o *obfuscator) preserveEncodedNames(files []*ast.File, info *types.Info, fset *token.FileSet) error {
+	struct_fields := make(map[string][]*types.Var)
+	var err error
+
+	// Exported fields are kept the way encoding/json needs them
+	converted := func(target types.Type, value ast.Expr) {
+		value_type := info.TypeOf(value)
+		if (target == nil || value_type == nil || types.IsInterface(value_type)) {
+			return
+		}
+		if interface_type, ok := target.Underlying().(*types.Interface); !ok || interface_type.NumMethods() > 0 {
+			return
+		}
+		reason := "converted to " + types.TypeString(target, nil) + " at " + fset.Position(value.Pos()).String()
+		o.preserveType(value_type, "encoding/json", reason, make(map[types.Type]bool))
+	}
+
+	var instances []*ast.Ident
+	for ident := range info.Instances {
+		instances = append(instances, ident)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Pos() < instances[j].Pos()
+	})
+	for _, ident := range instances {
+		type_args := info.Instances[ident].TypeArgs
+		for i := 0; i < type_args.Len(); i++ {
+			reason := "used as a type argument at " + fset.Position(ident.Pos()).String()
+			o.preserveType(type_args.At(i), "encoding/json", reason, make(map[types.Type]bool))
+		}
+	}
+
+	for _, file := range files {
+		// Enclosing nodes, return statements convert to the results of the innermost function
+		var stack []ast.Node
+		ast.Inspect(file, func(n ast.Node) bool {
+			if (n == nil) {
+				stack = stack[:len(stack) - 1]
+				return true
+			}
+
+			switch node := n.(type) {
+			case *ast.StructType:
+				struct_type, ok := info.Types[node].Type.(*types.Struct)
+				if (!ok) {
+					break
+				}
+				for i := 0; i < struct_type.NumFields(); i++ {
+					if (struct_type.Tag(i) != "") {
+						o.preserveObject(struct_type.Field(i), "has a struct tag")
+					}
+				}
+
+				key := types.TypeString(struct_type, nil)
+				if other_fields, exists := struct_fields[key]; exists {
+					for i := 0; i < struct_type.NumFields() && err == nil; i++ {
+						err = o.linkObjects(other_fields[i], struct_type.Field(i))
+					}
+				} else {
+					for i := 0; i < struct_type.NumFields(); i++ {
+						struct_fields[key] = append(struct_fields[key], struct_type.Field(i))
+					}
+				}
+
+			case *ast.CallExpr:
+				function, ok := calledObject(node, info).(*types.Func)
+				if (!ok || function.Pkg() == nil) {
+					break
+				}
+				if _, exists := encoding_packages[function.Pkg().Path()]; !exists {
+					break
+				}
+
+				reason := "passed to " + function.Pkg().Path() + "." + function.Name() + " at " + fset.Position(node.Pos()).String()
+				visited := make(map[types.Type]bool)
+				for _, arg := range node.Args {
+					if arg_type := info.TypeOf(arg); arg_type != nil {
+						o.preserveType(arg_type, function.Pkg().Path(), reason, visited)
+					}
+				}
+
+			case *ast.AssignStmt:
+				if (len(node.Lhs) == len(node.Rhs)) {
+					for i := range node.Lhs {
+						converted(info.TypeOf(node.Lhs[i]), node.Rhs[i])
+					}
+				}
+
+			case *ast.ValueSpec:
+				if (node.Type != nil) {
+					for _, value := range node.Values {
+						converted(info.TypeOf(node.Type), value)
+					}
+				}
+
+			case *ast.ReturnStmt:
+				for i := len(stack) - 1; i >= 0; i-- {
+					var function_type types.Type
+					switch function := stack[i].(type) {
+					case *ast.FuncDecl:
+						function_type = info.TypeOf(function.Name)
+					case *ast.FuncLit:
+						function_type = info.TypeOf(function)
+					default:
+						continue
+					}
+					if signature, ok := function_type.(*types.Signature); ok && signature.Results().Len() == len(node.Results) {
+						for j, result := range node.Results {
+							converted(signature.Results().At(j).Type(), result)
+						}
+					}
+					break
+				}
+
+			case *ast.SendStmt:
+				if channel, ok := typeUnderlying(info.TypeOf(node.Chan)).(*types.Chan); ok {
+					converted(channel.Elem(), node.Value)
+				}
+
+			case *ast.CompositeLit:
+				switch composite := typeUnderlying(info.TypeOf(node)).(type) {
+				case *types.Slice:
+					for _, element := range node.Elts {
+						if pair, ok := element.(*ast.KeyValueExpr); ok {
+							element = pair.Value
+						}
+						converted(composite.Elem(), element)
+					}
+				case *types.Array:
+					for _, element := range node.Elts {
+						if pair, ok := element.(*ast.KeyValueExpr); ok {
+							element = pair.Value
+						}
+						converted(composite.Elem(), element)
+					}
+				case *types.Map:
+					for _, element := range node.Elts {
+						if pair, ok := element.(*ast.KeyValueExpr); ok {
+							converted(composite.Key(), pair.Key)
+							converted(composite.Elem(), pair.Value)
+						}
+					}
+				case *types.Struct:
+					for i, element := range node.Elts {
+						if pair, ok := element.(*ast.KeyValueExpr); ok {
+							if field, ok := info.Uses[pair.Key.(*ast.Ident)].(*types.Var); ok {
+								converted(field.Type(), pair.Value)
+							}
+						} else if (i < composite.NumFields()) {
+							converted(composite.Field(i).Type(), element)
+						}
+					}
+				}
+			}
+
+			if call, ok := n.(*ast.CallExpr); ok {
+				if (info.Types[call.Fun].IsType() && len(call.Args) == 1) {
+					converted(info.Types[call.Fun].Type, call.Args[0])
+				} else if signature, ok := typeUnderlying(info.TypeOf(call.Fun)).(*types.Signature); ok {
+					for i, arg := range call.Args {
+						if (signature.Variadic() && i >= signature.Params().Len() - 1) {
+							if variadic, ok := signature.Params().At(signature.Params().Len() - 1).Type().(*types.Slice); ok && !call.Ellipsis.IsValid() {
+								converted(variadic.Elem(), arg)
+							}
+						} else if (i < signature.Params().Len()) {
+							converted(signature.Params().At(i).Type(), arg)
+						}
+					}
+				}
+			}
+
+			if (err != nil) {
+				return false
+			}
+			stack = append(stack, n)
+			return true
+		})
+	}
+	return err
+}
+
+// Underlying type of t, nil stays nil
+func typeUnderlying(t types.Type) types.Type {
+	if (t == nil) {
+		return nil
+	}
+	return t.Underlying()
+}
+
+func (o *obfuscator) preserveType(t types.Type, encoding_package string, reason string, visited map[types.Type]bool) {
+	if (visited[t]) {
+		return
+	}
+	visited[t] = true
+
+	switch node := t.(type) {
+	case *types.Alias:
+		o.preserveType(types.Unalias(node), encoding_package, reason, visited)
+	case *types.Named:
+		if (!o.isObfuscatedObject(node.Obj()) && node.TypeArgs().Len() == 0) {
+			return
+		}
+		if (encoding_packages[encoding_package]) {
+			o.preserveObject(node.Origin().Obj(), reason)
+		}
+		for i := 0; i < node.TypeArgs().Len(); i++ {
+			o.preserveType(node.TypeArgs().At(i), encoding_package, reason, visited)
+		}
+		o.preserveType(node.Underlying(), encoding_package, reason, visited)
+	case *types.Pointer:
+		o.preserveType(node.Elem(), encoding_package, reason, visited)
+	case *types.Slice:
+		o.preserveType(node.Elem(), encoding_package, reason, visited)
+	case *types.Array:
+		o.preserveType(node.Elem(), encoding_package, reason, visited)
+	case *types.Chan:
+		o.preserveType(node.Elem(), encoding_package, reason, visited)
+	case *types.Map:
+		o.preserveType(node.Key(), encoding_package, reason, visited)
+		o.preserveType(node.Elem(), encoding_package, reason, visited)
+	case *types.Struct:
+		for i := 0; i < node.NumFields(); i++ {
+			// Encoders skip unexported fields, reflection can reach all of them
+			if (node.Field(i).Exported() || encoding_package == "reflect") {
+				o.preserveObject(node.Field(i), reason)
+			}
+			o.preserveType(node.Field(i).Type(), encoding_package, reason, visited)
+		}
+	}
+}
+
+// Pins the name of obj and reports it, once per object
+func (o *obfuscator) preserveObject(obj types.Object, reason string) {
+	obj = originObject(obj)
+	if (!o.isObfuscatedObject(obj)) {
+		return
+	}
+	if type_name := embeddedTypeName(obj); type_name != nil {
+		obj = type_name
+	}
+
+	root := o.findObjectGroup(obj)
+	if (o.pinned_objects[root]) {
+		return
+	}
+	o.pinned_objects[root] = true
+
+	kind := "type"
+	switch object := obj.(type) {
+	case *types.Var:
+		kind = "variable"
+		if (object.IsField()) {
+			kind = "field"
+		}
+	case *types.Func:
+		kind = "function"
+	case *types.Const:
+		kind = "constant"
+	}
+	o.log("Preserving " + kind + " " + obj.Name() + ", " + reason)
+}
+
+// Returns the function or method a call refers to, nil for conversions and calls of function values
+func calledObject(call *ast.CallExpr, info *types.Info) types.Object {
+	switch function := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		return info.Uses[function]
+	case *ast.SelectorExpr:
+		return info.Uses[function.Sel]
+	case *ast.IndexExpr:
+		return calledObject(&ast.CallExpr{Fun: function.X}, info)
+	case *ast.IndexListExpr:
+		return calledObject(&ast.CallExpr{Fun: function.X}, info)
+	}
+	return nil
+}
+
+// An embedded field is named after its type, so it shares the name of the type declaration
+func embeddedTypeName(obj types.Object) types.Object {
+	field, ok := obj.(*types.Var)
+	if (!ok || !field.Embedded()) {
+		return nil
+	}
+
+	field_type := field.Type()
+	if pointer, ok := field_type.(*types.Pointer); ok {
+		field_type = pointer.Elem()
+	}
+	switch embedded := field_type.(type) {
+	case *types.Alias:
+		return embedded.Obj()
+	case *types.Named:
+		return embedded.Origin().Obj()
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/artemixer/gofuscator
+
+go 1.22
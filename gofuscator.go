@@ -1,893 +1,951 @@
-package main
+// Package gofuscator is an obfuscator/polymorphic engine for Go code. It renames
+// identifiers and imports and replaces strings, numbers and bools with equivalent
+// expressions that are hard to read back.
+package gofuscator
 
 import (
-	"flag"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/parser"
 	"go/token"
-	"go/printer"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
-	"strings"
+	"path/filepath"
+	"sort"
 	"strconv"
-	"math/rand"
-	"math"
+	"strings"
 	"time"
-	"io/ioutil"
-	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/base64"
-	"encoding/hex"
-	"unicode"
-	"hash/fnv"
 )
-var input_file = flag.String("i", "", "the path to the input file")
-var output_file = flag.String("o", "", "the path to the output file")
-var seed = flag.String("seed", "", "seed to use for code generation")
 
-var ignore_ints_bool = flag.Bool("no-ints", false, "disables int/float obfuscation")
-var ignore_strings_obfuscation_bool = flag.Bool("no-strings-obf", false, "disables string obfuscation")
-var ignore_strings_encryption_bool = flag.Bool("no-strings-enc", false, "disables string encryption")
-var ignore_vars_bool = flag.Bool("no-vars", false, "disables variable name obfuscation")
-var ignore_functions_bool = flag.Bool("no-functions", false, "disables function name/call obfuscation")
-var ignore_bools_bool = flag.Bool("no-bools", false, "disables bool obfuscation")
-var ignore_hexes_bool = flag.Bool("no-hexes", false, "disables hex value obfuscation")
-var ignore_imports_bool = flag.Bool("no-imports", false, "disables import obfuscation")
+// Config selects what gets obfuscated. The zero value obfuscates everything
+// except exported identifiers of module packages
+type Config struct {
+	// Seed to use for code generation, the same seed and input produce the same output.
+	// A time based seed is used when empty
+	Seed string
+
+	NoInts bool // disables int/float obfuscation
+	NoStringsObfuscation bool // disables string obfuscation
+	NoStringsEncryption bool // disables string encryption
+	NoVars bool // disables variable name obfuscation
+	NoFunctions bool // disables function name/call obfuscation
+	NoMethods bool // disables method name obfuscation
+	NoTypes bool // disables type name obfuscation
+	NoFields bool // disables struct field name obfuscation
+	NoBools bool // disables bool obfuscation
+	NoHexes bool // disables hex value obfuscation
+	NoImports bool // disables import obfuscation
+
+	// Scheme strings are encrypted with, one of Ciphers(). "random" picks one for every
+	// string, aes-cbc is used when empty
+	Cipher string
+
+	// Also obfuscates exported identifiers when processing a module
+	Exported bool
+
+	// Names of the passes to run, in order. DefaultPasses are used when empty,
+	// followed by Transformers. Dependencies of a pass are moved in front of it
+	Passes []string
+	// Names of the passes to leave out of the pipeline
+	DisabledPasses []string
+	// Passes of this run only, on top of the registered ones. A pass replaces
+	// the registered pass with the same name
+	Transformers []Transformer
+
+	// Path of the obfuscation map to write, listing every renamed identifier
+	// with its kind, package, original position and new name
+	MapFile string
+	// Path of the obfuscation map of a previous run. Symbols found in it keep their names,
+	// only new symbols get new ones, and the added and removed symbols are logged
+	ReuseMapFile string
+	// Disables type checking after every pass, which reverts the changes that break compilation
+	NoVerify bool
+	// Adds line directives, so positions in stack traces are the original lines
+	// of files with obfuscated names, listed in the obfuscation map
+	LineDirectives bool
+	// Path of the journal to write, listing every change kept by the run
+	JournalFile string
+	// Journal of a previous run to replay with its seed. Changes that are not listed
+	// in it are reverted as soon as their pass is done
+	Replay *Journal
+
+	// Receives warnings and the names that had to be preserved, nothing is logged when nil
+	Log io.Writer
+}
 
+// State of a single run, nothing is shared between runs
+type obfuscator struct {
+	config Config
+	rand *rand.Rand
+
+	// New names of renamed declarations, keyed by the object they declare
+	names_dictionary map[types.Object]string
+	// New names kept by the packages already processed, their renames are not reverted anymore
+	emitted_names map[string]bool
+	// New names of the helpers and imports added by the tool, keyed by package and original name
+	generated_names map[string]string
+	current_package string
+	// Names used by the files of the current package that are left out of the build, keyed to the file,
+	// and the names they select or use as keys, which can be methods or fields
+	excluded_names map[string]string
+	excluded_members map[string]string
+	// Path of the types package being processed, the package name outside of module mode
+	current_path string
+	current_types_package *types.Package
+
+	// Packages of the module being processed, keyed by import path
+	module_packages map[string]*modulePackage
+
+	// Methods and fields that have to keep matching names, each linked towards the root of its group
+	linked_objects map[types.Object]types.Object
+	// Groups of methods across the packages of the module, keyed by method key, the pinned ones
+	// and the first method renamed of each
+	module_method_groups map[string]string
+	pinned_module_groups map[string]bool
+	group_representatives map[string]types.Object
+	// Group roots that cannot be renamed, as some member is required by code outside of the obfuscated
+	// packages or is looked up by name at runtime
+	pinned_objects map[types.Object]bool
+	// Exported method signatures of every package outside of the obfuscated ones, by name
+	external_methods map[string][]*types.Signature
+	scanned_packages map[*types.Package]bool
+
+	// Files of the output, only written once the whole run succeeded
+	staged_files []stagedFile
+
+	mapping Mapping
+	recorded_symbols map[string]bool
+	journal Journal
+	replay_entries map[string]JournalEntry
+
+	// Names of the reused mapping, keyed by symbol
+	previous_mapping *Mapping
+	previous_names map[string][]string
+	previous_generated map[string]string
+	reserved_names map[string]bool
+
+	// Whether the pipeline has a rename pass
+	renames bool
+	// Ciphers strings can be encrypted with, and the secret their keys are derived from
+	ciphers []Cipher
+	master_secret []byte
+	key_shares [][]byte
+	strings_encrypted uint64
+}
 
-var names_dictionary map[string]string = make(map[string]string)
 var unicode_chars = []rune("аa")
-var int_seed = int64(0)
-
-var aes_key_obf string
-var iv_obf string
-
-// Workflow
-//	Replace 'const' with 'var'
-//	Write and read
-//	Add import 'math'
-//	Write and read
-// 	Obfuscate variable names
-// 	Get imports list
-// 	Obfuscate bools
-// 	Obfuscate function decls
-// 	Obfuscate function calls
-// 	Obfuscate strings
-//	Write and read
-// 	Obfuscate ints
-// 	Obfuscate floats
-// 	Obfuscate import aliases
-//	Write and read
-//	Add math operations array
-//	Replace referrences to math operations
-//	Replace import refferences
-
-func main() {
-	flag.Parse()
-	if (len(*input_file) < 1) {
-		fmt.Println("Please provide an input file with '--i'")
-	}
-	if (len(*output_file) < 1) {
-		fmt.Println("Please provide an output file with '--i'")
-	}
-
-	string_seed := *seed
-	if (len(string_seed) > 0) {
-		int_seed = int64(hashString(string_seed))
-	} else {
-		int_seed = time.Now().UnixNano()
+var global_debug_level = 1
+
+func newObfuscator(config Config) (*obfuscator, error) {
+	o := &obfuscator{
+		config: config,
+		names_dictionary: make(map[types.Object]string),
+		emitted_names: make(map[string]bool),
+		generated_names: make(map[string]string),
+		module_packages: make(map[string]*modulePackage),
+		linked_objects: make(map[types.Object]types.Object),
+		module_method_groups: make(map[string]string),
+		pinned_module_groups: make(map[string]bool),
+		group_representatives: make(map[string]types.Object),
+		pinned_objects: make(map[types.Object]bool),
+		external_methods: make(map[string][]*types.Signature),
+		scanned_packages: make(map[*types.Package]bool),
+		recorded_symbols: make(map[string]bool),
+		previous_names: make(map[string][]string),
+		previous_generated: make(map[string]string),
+		reserved_names: make(map[string]bool),
+	}
+
+	// The seed is kept in the journal, so a time based seed is turned into a string as well
+	if (config.Replay != nil) {
+		o.config.Seed = config.Replay.Seed
+		o.replay_entries = make(map[string]JournalEntry)
+		for _, entry := range config.Replay.Entries {
+			o.replay_entries[entry.Key] = entry
+		}
 	}
-	rand.Seed(int_seed)
-
-	aes_key_obf_byte := make([]byte, 16)
-	_, err := rand.Read(aes_key_obf_byte)
-	aes_key_obf = hex.EncodeToString(aes_key_obf_byte)
-
-	iv_obf_byte := make([]byte, 8)
-	_, err = rand.Read(iv_obf_byte)
-	iv_obf = hex.EncodeToString(iv_obf_byte)
-
+	if (len(o.config.Seed) == 0) {
+		o.config.Seed = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	o.journal.Seed = o.config.Seed
+	o.rand = rand.New(rand.NewSource(int64(hashString(o.config.Seed))))
 
-	// Parse the file
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, *input_file, nil, 0)
+	err := o.selectCiphers()
 	if err != nil {
-		fmt.Println("Error parsing file:", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	// Replace all consts with var
-	ast.Inspect(file, func(n ast.Node) bool {
-		if genDecl, ok := n.(*ast.GenDecl); ok && genDecl.Tok == token.CONST {
-			genDecl.Tok = token.VAR
+	if (config.ReuseMapFile != "") {
+		err = o.loadPreviousMapping(config.ReuseMapFile)
+		if err != nil {
+			return nil, err
 		}
-		return true
-	})
-
-	writeToOutputFile(*output_file, file, fset)
-	fset = token.NewFileSet()
-	file, err = parser.ParseFile(fset, *output_file, nil, parser.ParseComments)
+	}
+	return o, nil
+}
 
-	// Adding AES functions
-	if (!*ignore_strings_encryption_bool) { 
-		file, fset = addAESFunctions(file, fset)
-		file, fset = addImport(file, fset, "crypto/aes")
-		file, fset = addImport(file, fset, "crypto/cipher")
-		file, fset = addImport(file, fset, "encoding/base64")
+// Obfuscate obfuscates the source of a single Go file
+func Obfuscate(source []byte, config Config) ([]byte, error) {
+	o, err := newObfuscator(config)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := o.obfuscateSources([]string{"input.go"}, [][]byte{source})
+	if err != nil {
+		return nil, err
 	}
+	return outputs[0], o.writeOutputs()
+}
 
-	if (!*ignore_ints_bool) { 
-		file, fset = addImport(file, fset, "math") 
-		file, fset = addImport(file, fset, "reflect") 
+// ObfuscateFile obfuscates the Go file at input_path and writes the result to output_path
+func ObfuscateFile(input_path string, output_path string, config Config) error {
+	o, err := newObfuscator(config)
+	if err != nil {
+		return err
+	}
+	err = o.obfuscateFiles([]string{input_path}, []string{output_path})
+	if err != nil {
+		return err
 	}
+	return o.writeOutputs()
+}
 
-	writeToOutputFile(*output_file, file, fset)
-	fset = token.NewFileSet()
-	file, err = parser.ParseFile(fset, *output_file, nil, parser.ParseComments)
+// ObfuscateDir obfuscates the package in input_dir into a mirrored output_dir. If input_dir
+// contains a go.mod, every package of the module is obfuscated
+func ObfuscateDir(input_dir string, output_dir string, config Config) error {
+	o, err := newObfuscator(config)
+	if err != nil {
+		return err
+	}
+	if _, stat_err := os.Stat(filepath.Join(input_dir, "go.mod")); stat_err == nil {
+		err = o.obfuscateModule(input_dir, output_dir)
+	} else {
+		err = o.obfuscatePackageDir(input_dir, output_dir, "")
+	}
+	if err != nil {
+		return err
+	}
+	return o.writeOutputs()
+}
 
-	// Find variable names
-	ast.Inspect(file, func(n ast.Node) bool {
-		if ident, ok := n.(*ast.Ident); ok {
-			// Check if it is a variable (not a type, function, etc.)
-			if ident.Obj != nil && (ident.Obj.Kind == ast.Var) && ident.Name != "_" && !*ignore_vars_bool {
-				ident.Name = obfuscateVariableName(ident.Name)
-			}
+// Writes the staged files, the obfuscation map and the journal of the run
+func (o *obfuscator) writeOutputs() error {
+	for _, file := range o.staged_files {
+		directory := filepath.Dir(file.path)
+		if (file.directory) {
+			directory = file.path
 		}
-		return true
-	})
-
-	// Write import paths to array
-	var importPaths []string
-	for _, decl := range file.Decls {
-		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
-			// Found an import declaration
-			for _, spec := range genDecl.Specs {
-				if importSpec, ok := spec.(*ast.ImportSpec); ok {
-					// Extract the import path
-					importPath := removeChar(importSpec.Path.Value, "\""[0])
-					importPaths = append(importPaths, importPath)
-				}
-			}
+		err := os.MkdirAll(directory, 0755)
+		if err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
 		}
-	}
-
-	ast.Inspect(file, func(n ast.Node) bool {
-		if ident, ok := n.(*ast.Ident); ok {
-			if ident.Obj == nil && (ident.Name == "true" || ident.Name == "false") && !*ignore_bools_bool {
-				ident.Name = obfuscateBool(ident.Name)
-			}
+		if (file.directory) {
+			continue
 		}
-		return true
-	})
-
-	var functions_list []string
-	ast.Inspect(file, func(n ast.Node) bool {
-		switch node := n.(type) {
-		case *ast.FuncDecl:
-			// Check if it is the old function name and declared in the current file
-			if node.Name.Name != "main" && node.Recv == nil && node.Name.Obj != nil && node.Name.Obj.Pos().IsValid() && fset.Position(node.Name.Obj.Pos()).Filename == *output_file && !*ignore_functions_bool {
-				functions_list = append(functions_list, node.Name.Name)
-				node.Name.Name = obfuscateFunctionName(node.Name.Name)
-			}
 
-		case *ast.CallExpr:
-			// Check if it is a function call
-			if ident, ok := node.Fun.(*ast.Ident); ok {
-				// Check if it is the old function name and declared in the current file
-				if ((ident.Name != "main" && ident.Obj != nil && ident.Obj.Pos().IsValid() && fset.Position(ident.Obj.Pos()).Filename == *output_file) || isInArray(ident.Name, functions_list)) && !*ignore_functions_bool {
-					ident.Name = obfuscateFunctionName(ident.Name)
-				}
-			}
-		case *ast.BasicLit:
-			// Check if it is a string literal
-			if node.Kind == token.STRING && !isInArray(trimFirstLastChars(node.Value), importPaths) {
-				if (trimFirstLastChars(node.Value) != aes_key_obf && trimFirstLastChars(node.Value) != string(iv_obf) && !*ignore_strings_encryption_bool) {
-					node.Value = string(obfuscateFunctionName("aesDecrypt") + "(" + obfuscateString(aesEncrypt(trimFirstLastChars(node.Value))) + ")")
-				} else {
-					node.Value = obfuscateString(trimFirstLastChars(node.Value))
-				}
-			}
-			
+		err = writeFileAtomic(file.path, file.content)
+		if err != nil {
+			return err
 		}
-		return true
-	})
-
-	debug(functions_list)
-
+	}
+	o.staged_files = nil
 
-	writeToOutputFile(*output_file, file, fset)
-	fset = token.NewFileSet()
-	file, err = parser.ParseFile(fset, *output_file, nil, parser.ParseComments)
+	err := o.writeMapping()
+	if err != nil {
+		return err
+	}
+	return o.writeJournal()
+}
 
-	ast.Inspect(file, func(n ast.Node) bool {
-		switch node := n.(type) {
+func (o *obfuscator) log(a ...interface{}) {
+	if (o.config.Log != nil) {
+		fmt.Fprintln(o.config.Log, a...)
+	}
+}
 
-		case *ast.BasicLit:
-			if node.Kind == token.INT {
-				if (containsNonNumericChars(node.Value)) {
-					node.Value = obfuscateHex(node.Value)
-				} else {
-					integer_value, _ := strconv.Atoi(node.Value)
-					node.Value = obfuscateIntFloat(float64(integer_value))
-				}
-			}
-			if node.Kind == token.FLOAT {
-				float_value, _ := strconv.ParseFloat(node.Value, 64)
-				node.Value = obfuscateIntFloat(float64(float_value))
-				//debug(node.Value)
-			}
-			
+// Default workflow, every step is a pass that can be disabled or reordered through Config
+//	lines		Add line directives
+//	consts		Replace 'const' with 'var' where the constants are not required
+//	ciphers		Add the keys and decrypt functions of the string ciphers
+//	typecheck	Type check, group methods by interface satisfaction
+//			and preserve fields and types used by encoders and reflection
+// 	bools		Obfuscate bools
+// 	rename		Obfuscate variable, function, method, type and field names
+// 	strings		Obfuscate strings
+// 	ints		Reparse, add imports 'math' and 'reflect', obfuscate ints, floats, imaginary numbers and runes
+//	operations	Reparse, add math operations array, replace referrences to math operations
+// 	imports		Reparse, obfuscate import aliases and replace import refferences
+
+// Runs the pipeline over files of a single package and stages the results, they are written
+// by writeOutputs once the whole run succeeded, so a failure leaves the output files untouched
+func (o *obfuscator) obfuscateFiles(input_paths []string, output_paths []string) error {
+	var sources [][]byte
+	for _, input_path := range input_paths {
+		source, err := ioutil.ReadFile(input_path)
+		if err != nil {
+			return fmt.Errorf("reading file: %w", err)
 		}
-		return true
-	})
-
-	var imports_array []string
-	for _, decl := range file.Decls {
-        genDecl, ok := decl.(*ast.GenDecl)
-        if !ok || genDecl.Tok != token.IMPORT || *ignore_imports_bool {
-            continue
-        }
-
-        for _, spec := range genDecl.Specs {
-            importSpec, ok := spec.(*ast.ImportSpec)
-            if !ok {
-                continue
-            }
-
-            importSpec.Name = &ast.Ident{Name: obfuscateFunctionName(strings.Split(strings.Trim(importSpec.Path.Value, "\""), "/")[len(strings.Split(strings.Trim(importSpec.Path.Value, "\""), "/"))-1])}
-			imports_array = append(imports_array, strings.Split(strings.Trim(importSpec.Path.Value, "\""), "/")[len(strings.Split(strings.Trim(importSpec.Path.Value, "\""), "/"))-1])
-        }
-    }
-	
+		sources = append(sources, source)
+	}
 
-	writeToOutputFile(*output_file, file, fset)
-	fset = token.NewFileSet()
-	file, err = parser.ParseFile(fset, *output_file, nil, parser.ParseComments)
+	outputs, err := o.obfuscateSources(input_paths, sources)
+	if err != nil {
+		return err
+	}
 
-	// Adding math operation array
-	if (!*ignore_ints_bool) {
-		file = addGlobalVar(file, obfuscateVariableName("operations_array_obf"), "string", token.STRING, "operations_array_here")
+	for i, output_path := range output_paths {
+		o.staged_files = append(o.staged_files, stagedFile{path: output_path, content: outputs[i]})
 	}
+	return nil
+}
 
-	writeToOutputFile(*output_file, file, fset)
+// Runs the pipeline over the sources of a single package in memory, all of them sharing
+// one file set and one rename table. The first file hosts the generated helpers
+func (o *obfuscator) obfuscateSources(file_names []string, sources [][]byte) ([][]byte, error) {
+	pipeline, err := o.buildPipeline()
+	if err != nil {
+		return nil, err
+	}
+	o.renames = false
+	for _, t := range pipeline {
+		o.renames = o.renames || t.Name() == "rename"
+	}
 
-	// Read the file contents
-	content, err := ioutil.ReadFile(*output_file)
+	// Parse the files, comments are dropped apart from the ones the go tool reads
+	files, fset, err := parseSources(file_names, sources, parser.ParseComments)
 	if err != nil {
-		fmt.Println("Error reading file:", err)
-		os.Exit(1)
+		return nil, err
 	}
-	
-	modifiedContent := string(content)
-	for i := 0; i < len(imports_array); i++ {
-		modifiedContent = strings.ReplaceAll(modifiedContent, imports_array[i] + ".", obfuscateFunctionName(imports_array[i]) + ".")
+	for i, file := range files {
+		keepDirectives(file, strings.HasSuffix(file_names[i], "_test.go"))
 	}
+	o.current_path = o.current_package
+	if (o.current_path == "") {
+		o.current_path = files[0].Name.Name
+	}
+	pkg := &Package{Path: o.current_package, Files: files, Fset: fset, o: o, file_names: file_names}
 
-	operations_str := []interface{}{
-		"math.Sqrt",
-		"math.Sin", 
-		"math.Cos", 
-		"math.Log", 
-		"math.Tan",
-		"math.Cbrt", 
+	var baseline map[string]checkError
+	if (!o.config.NoVerify) {
+		baseline, pkg.checked_types = o.checkPackage(pkg)
 	}
-	operations_str = shuffle(operations_str)
 
-	if (!*ignore_ints_bool) {
-		operations_array_str := "[]func(x float64)(float64){"
-		for i := 0; i < len(operations_str); i++ {
-			operations_array_str = operations_array_str + operations_str[i].(string) + ","
-		}
-		operations_array_str = operations_array_str + "}"
-		if (!*ignore_imports_bool) {
-			operations_array_str = strings.ReplaceAll(operations_array_str, `math`, obfuscateFunctionName("math"))
+	for _, t := range pipeline {
+		pkg.changes = nil
+		pkg.line_changes = make(map[string]int)
+		err = t.Transform(pkg)
+		if err != nil {
+			return nil, fmt.Errorf("pass %s: %w", t.Name(), err)
 		}
 
-		modifiedContent = strings.ReplaceAll(modifiedContent, `string = operations_array_here`, `= ` + operations_array_str)
-		
-		for i := 0; i < len(operations_str); i++ {
-			real_operation := ""
-			if (!*ignore_imports_bool) {
-				real_operation = strings.ReplaceAll(operations_str[i].(string), `math`, obfuscateFunctionName("math"))
-			} else {
-				real_operation = operations_str[i].(string)
-			}
-			modifiedContent = strings.ReplaceAll(modifiedContent, real_operation + "(", obfuscateVariableName("operations_array_obf") + "[" + obfuscateIntFloat(float64(i)) + "](")
-			modifiedContent = strings.ReplaceAll(modifiedContent, real_operation + ")", obfuscateVariableName("operations_array_obf") + "[" + obfuscateIntFloat(float64(i)) + "])")
+		if (o.config.Replay != nil) {
+			o.replayChanges(pkg, t.Name())
 		}
-
-		if (!*ignore_imports_bool) {
-			modifiedContent = strings.ReplaceAll(modifiedContent, `math.`, obfuscateFunctionName("math") + ".")
-			modifiedContent = strings.ReplaceAll(modifiedContent, `reflect.`, obfuscateFunctionName("reflect") + ".")
+		if (!o.config.NoVerify) {
+			baseline, err = o.verifyPass(pkg, t.Name(), baseline)
+			if err != nil {
+				return nil, err
+			}
 		}
+		o.journalChanges(pkg, t.Name())
 	}
-
-	// Write the modified content back to the file
-	err = ioutil.WriteFile(*output_file, []byte(modifiedContent), 0644)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		os.Exit(1)
+	pkg.changes = nil
+	for _, name := range o.names_dictionary {
+		o.emitted_names[name] = true
 	}
-	
 
+	// Packages importing this one are verified against its obfuscated version
+	if module_package, exists := o.module_packages[o.current_package]; exists {
+		module_package.obfuscated_types = pkg.checked_types
+	}
 
+	return o.printPackage(pkg)
 }
 
-
-
-func obfuscateIntFloat(real_value float64) string {
-	if (*ignore_ints_bool) {
-		return strconv.FormatFloat(real_value, 'f', -1, 64)
+// Replaces consts with var, where every use of the constants tolerates a variable
+func (o *obfuscator) replaceConsts(pkg *Package) error {
+	variable_decls := o.variableConsts(pkg)
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if genDecl, ok := n.(*ast.GenDecl); ok && genDecl.Tok == token.CONST && variable_decls[genDecl] {
+				pkg.record(genDecl, "", func() {
+					genDecl.Tok = token.CONST
+				})
+				genDecl.Tok = token.VAR
+			}
+			return true
+		})
 	}
+	return nil
+}
 
-	var terms_array []string
-	var terms_value_array []float64
-	var operations_array []string
-	
-	terms_amount := rand.Intn(1) + 2
-	
-	possible_operations_array := []string{"*", "/"}
-	possible_modifiers_array := []string{"Sqrt", "Sin", "Cos", "Log", "Tan", "Frexp", "Hypot", "Cbrt"}
-	possible_reversible_modifiers_array := []string{"Tan", "Frexp", "Cbrt"}
-
-	// Generate random numbers and operations
-	i := 0
-	for {
-		i = i + 1
-		if (i > terms_amount) {
-			break
-		}
-
-		var value float64 = float64(rand.Intn(100000000000000000) + 1) / 10000000000000000
-		terms_value_array = append(terms_value_array, float64(value))
-		terms_array = append(terms_array, strconv.FormatFloat(value, 'f', -1, 64))
-		operations_array = append(operations_array, possible_operations_array[rand.Intn(len(possible_operations_array))])
-
+// Type checks the package and runs the analyses deciding which names have to stay
+func (o *obfuscator) typeCheck(pkg *Package) error {
+	pkg.Info = o.typeCheckFiles(pkg.Files, pkg.Fset)
+	pkg.Types = o.current_types_package
+	err := o.groupMethods(pkg.Files, pkg.Info, pkg.Fset)
+	if err != nil {
+		return err
+	}
+	err = o.preserveEncodedNames(pkg.Files, pkg.Info, pkg.Fset)
+	if err != nil {
+		return err
 	}
-	operations_array = operations_array[:len(operations_array)-1]
 
-	i = 0
-	for {
-		if (i >= terms_amount) {
-			break
+	// go test finds the tests, benchmarks, examples and fuzz targets of test files by name
+	for i, file := range pkg.Files {
+		if (!strings.HasSuffix(pkg.file_names[i], "_test.go")) {
+			continue
 		}
-
-		// If the term is not the last in the string, just select a random modifier for it
-		// TODO Add randomisation between reflect and normal
-		if (i+1 < terms_amount) {
-			modifier := possible_modifiers_array[rand.Intn(len(possible_modifiers_array))]
-			if (modifier == "Sqrt") {
-				terms_value_array[i] = math.Sqrt(terms_value_array[i])
-				terms_array[i] = "reflect.ValueOf(math.Sqrt).Call([]reflect.Value{reflect.ValueOf(" + terms_array[i] + ")})[0].Interface().(float64)"
-			} else if (modifier == "Sin") {	
-				terms_value_array[i] = math.Sin(terms_value_array[i])
-				terms_array[i] = "reflect.ValueOf(math.Sin).Call([]reflect.Value{reflect.ValueOf(" + terms_array[i] + ")})[0].Interface().(float64)"
-			} else if (modifier == "Cos") {
-				terms_value_array[i] = math.Cos(terms_value_array[i])
-				terms_array[i] = "reflect.ValueOf(math.Cos).Call([]reflect.Value{reflect.ValueOf(" + terms_array[i] + ")})[0].Interface().(float64)"
-			} else if (modifier == "Log") {
-				terms_value_array[i] = math.Log(terms_value_array[i])
-				terms_array[i] = "reflect.ValueOf(math.Log).Call([]reflect.Value{reflect.ValueOf(" + terms_array[i] + ")})[0].Interface().(float64)"
-			} else if (modifier == "Tan") {
-				terms_value_array[i] = math.Tan(terms_value_array[i])
-				terms_array[i] = "reflect.ValueOf(math.Tan).Call([]reflect.Value{reflect.ValueOf(" + terms_array[i] + ")})[0].Interface().(float64)"
-			} else if (modifier == "Cbrt") {
-				terms_value_array[i] = math.Cbrt(terms_value_array[i])
-				terms_array[i] = "reflect.ValueOf(math.Cbrt).Call([]reflect.Value{reflect.ValueOf(" + terms_array[i] + ")})[0].Interface().(float64)"
-			} else if (modifier == "Frexp") {
-				exponent := float64((rand.Intn(100000000000000000) + 1) - 50000000000000000) / 10000000000000000
-				terms_value_array[i] = terms_value_array[i]*math.Pow(3, float64(exponent))
-				terms_array[i] = "(" +terms_array[i] + "*reflect.ValueOf(math.Pow).Call([]reflect.Value{reflect.ValueOf(float64(2)), reflect.ValueOf(float64(" + strconv.FormatFloat(exponent, 'f', -1, 64) + ") )})[0].Interface().(float64))"
-			} else if (modifier == "Hypot") {
-				exponent := float64((rand.Intn(100000000000000000) + 1) - 50000000000000000) / 10000000000000000
-				terms_value_array[i] = math.Hypot(terms_value_array[i], exponent)
-				terms_array[i] = "(reflect.ValueOf(math.Hypot).Call([]reflect.Value{reflect.ValueOf(float64(" + terms_array[i] + ")), reflect.ValueOf(float64(" + strconv.FormatFloat(exponent, 'f', -1, 64) + ") )})[0].Interface().(float64))"
-			}
-
-		} else {
-			x := 0
-			total := terms_value_array[0]
-			for {
-				if (x+2 >= terms_amount) {
-					break
-				}
-
-				if (operations_array[x] == "*") {
-					total = total * terms_value_array[x+1]
-				} else if (operations_array[x] == "/") {
-					total = total / terms_value_array[x+1]
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Recv == nil && isTestFunctionName(funcDecl.Name.Name) {
+				if obj := pkg.Info.Defs[funcDecl.Name]; obj != nil {
+					o.pinned_objects[o.findObjectGroup(obj)] = true
 				}
-
-				x = x + 1
-			}
-
-			target_num := 0.0
-			if (operations_array[len(operations_array)-1] == "*") {
-				target_num = real_value / total
-			} else if (operations_array[len(operations_array)-1] == "/") {
-				target_num = total / real_value
-			}
-
-			modifier := possible_reversible_modifiers_array[rand.Intn(len(possible_reversible_modifiers_array))]
-			var exponent int
-			var target_modified_num float64
-			for {
-				if (modifier == "Tan") {
-					target_modified_num = math.Atan(target_num)
-					terms_value_array[i] = target_num
-					terms_array[i] = "math.Tan(" + strconv.FormatFloat(target_modified_num, 'f', -1, 64) + ")"
-				} else if (modifier == "Frexp") {
-					target_modified_num, exponent = math.Frexp(target_num)
-					terms_value_array[i] = target_num
-					terms_array[i] = "(" + strconv.FormatFloat(target_modified_num, 'f', -1, 64) + "*math.Pow(3, float64(" + strconv.Itoa(exponent) + ")))"
-				} else if (modifier == "Cbrt") {
-					target_modified_num = math.Pow(target_num, 3)
-					terms_value_array[i] = target_num
-					terms_array[i] = "math.Cbrt(" + strconv.FormatFloat(target_modified_num, 'f', -1, 64) + ")"
-				} 	
-
-				// Checking for infinity overflows
-				if strings.Contains(strconv.FormatFloat(target_modified_num, 'f', -1, 64), "Inf") {
-					modifier = "Tan"
-					continue
-				} else {
-					break
+				if (strings.HasPrefix(funcDecl.Name.Name, "Example")) {
+					o.preserveExampleSubject(pkg, funcDecl.Name.Name)
 				}
 			}
-
 		}
-
-		i = i + 1
 	}
-	
-
-	// Append the arrays to form the output string
-	result_string := ""
-	x := 0
-	for {
-		if (x >= terms_amount) {
-			break
-		}
 
-		result_string = result_string + terms_array[x]
-		if (x + 1 < terms_amount) {
-			result_string = result_string + operations_array[x]
+	// Files left out of the build are copied as is, so the declarations they refer to keep their names
+	var excluded_names []string
+	for name := range o.excluded_names {
+		excluded_names = append(excluded_names, name)
+	}
+	sort.Strings(excluded_names)
+	for _, name := range excluded_names {
+		if obj := pkg.Types.Scope().Lookup(name); obj != nil && o.shouldRenameObject(obj) {
+			o.preserveObject(obj, "used by " + o.excluded_names[name] + ", which is not built on this platform")
 		}
-
-		x = x + 1
 	}
-
-	// Find the decimal places of the input and round the output to those decimal places
-	str := strconv.FormatFloat(real_value, 'f', -1, 64)
-    parts := strings.Split(str, ".")
-	decimal_places := 0
-    if len(parts) == 2 {
-    	decimal_places = len(parts[1])
-    } else {
-        decimal_places = 0
-    }
-	divider := int(math.Pow(float64(10), float64(decimal_places)))
-
-	if (divider > 1) {
-		result_string = "((math.Round((" + result_string + "*" +  strconv.Itoa(divider) + ")))/" + strconv.Itoa(divider) + ")"
-	} else {
-		result_string = "(int(math.Round(" + result_string + ")))"
-
+	if (len(o.excluded_members) > 0) {
+		o.preserveExcludedMembers(pkg)
 	}
 
-
-	//fmt.Println(result_string)
-	return result_string
+	// The linker finds the declarations named by //go:linkname and //export directives by name
+	for _, file := range pkg.Files {
+		for _, name := range directiveNames(file, o.current_path) {
+			if obj := pkg.Types.Scope().Lookup(name); obj != nil && o.shouldRenameObject(obj) {
+				o.preserveObject(obj, "named by a directive in " + pkg.Fset.Position(file.Package).Filename)
+			}
+		}
+	}
+	return nil
 }
 
-func obfuscateVariableName(real_value string) string {
-	if (*ignore_vars_bool) {
-		return real_value
+// Pins the methods and fields of the types declared by the package that files left out of the
+// build select by name
+func (o *obfuscator) preserveExcludedMembers(pkg *Package) {
+	var type_names []*types.TypeName
+	for _, obj := range pkg.Info.Defs {
+		if type_name, ok := obj.(*types.TypeName); ok && type_name.Pkg() == pkg.Types {
+			type_names = append(type_names, type_name)
+		}
 	}
+	sort.Slice(type_names, func(i, j int) bool {
+		return type_names[i].Pos() < type_names[j].Pos()
+	})
 
-	if _, exists := names_dictionary[real_value]; !exists {
-		var result []rune
-		for i := 0; i < 20; i++ {
-			result = append(result, unicode_chars[rand.Intn(len(unicode_chars))])
-		}
-		if valueExists(names_dictionary, string(result)) {
-			debug("again")
-			return obfuscateFunctionName(real_value)
+	preserve := func(obj types.Object) {
+		if file_name, exists := o.excluded_members[obj.Name()]; exists && o.shouldRenameObject(obj) {
+			o.preserveObject(obj, "used by " + file_name + ", which is not built on this platform")
 		}
-		names_dictionary[real_value] = string(result)
 	}
-	return names_dictionary[real_value]
-}
-
-func obfuscateFunctionName(real_value string) string {
-	if (*ignore_functions_bool) {
-		return real_value
+	var preserveFields func(t types.Type)
+	preserveFields = func(t types.Type) {
+		switch node := t.(type) {
+		case *types.Struct:
+			for i := 0; i < node.NumFields(); i++ {
+				preserve(node.Field(i))
+				// Fields of anonymous structs nested in the type
+				if (!node.Field(i).Embedded()) {
+					preserveFields(node.Field(i).Type())
+				}
+			}
+		case *types.Pointer:
+			preserveFields(node.Elem())
+		case *types.Slice:
+			preserveFields(node.Elem())
+		case *types.Array:
+			preserveFields(node.Elem())
+		case *types.Map:
+			preserveFields(node.Elem())
+		case *types.Interface:
+			for i := 0; i < node.NumExplicitMethods(); i++ {
+				preserve(node.ExplicitMethod(i))
+			}
+		}
 	}
 
-	if _, exists := names_dictionary[real_value]; !exists {
-		var result []rune
-		for i := 0; i < 20; i++ {
-			result = append(result, unicode_chars[rand.Intn(len(unicode_chars))])
+	for _, type_name := range type_names {
+		named, ok := type_name.Type().(*types.Named)
+		if (!ok) {
+			continue
 		}
-		if valueExists(names_dictionary, string(result)) {
-			return obfuscateFunctionName(real_value)
+		for i := 0; i < named.NumMethods(); i++ {
+			preserve(named.Method(i))
 		}
-		names_dictionary[real_value] = string(result)
+		preserveFields(named.Underlying())
 	}
-	return names_dictionary[real_value]
 }
 
-func obfuscateString(real_value string) string {
-	if (*ignore_strings_obfuscation_bool) {
-		return `"` + real_value + `"`
+// go vet requires the function, type or method an example is named after, such as
+// ExampleBuffer_Write, to exist under that name
+func (o *obfuscator) preserveExampleSubject(pkg *Package, example_name string) {
+	parts := strings.Split(strings.TrimPrefix(example_name, "Example"), "_")
+	if (parts[0] == "") {
+		return
 	}
-
-	real_value, _ = strconv.Unquote(`"` + real_value + `"`)
-	byte_array := []byte(real_value)
-	result_string := "" 
-	i := 0
-
-	if (real_value == "") {
-		return `""`
+	obj := pkg.Types.Scope().Lookup(parts[0])
+	if (obj == nil) {
+		return
 	}
+	reason := "named by " + example_name
+	o.preserveObject(obj, reason)
 
-	if (len(byte_array) != len(real_value)) {
-		// TODO Add support for multiple-byte encodings
-		return real_value
-	}
-
-	for _, b := range byte_array {
-        // Convert byte to int
-        int_value := int(b)
-
-		result_string = result_string + "string(" + strconv.Itoa(int_value) + ")"
-		
-		if (i != len(byte_array)-1) {
-			result_string = result_string + "+"
+	if type_name, ok := obj.(*types.TypeName); ok && len(parts) > 1 && ast.IsExported(parts[1]) {
+		if method, _, _ := types.LookupFieldOrMethod(type_name.Type(), true, pkg.Types, parts[1]); method != nil {
+			o.preserveObject(method, reason)
 		}
-		
-		i = i + 1
 	}
-
-	result_string = "(" + result_string + ")"
-	return result_string
 }
 
-func obfuscateBool(real_value string) string {
-	if (*ignore_bools_bool) {
-		return real_value
+func requireTypes(pkg *Package) error {
+	if (pkg.Info == nil) {
+		return errors.New("no type information, the typecheck pass has to run after the last reparse")
 	}
-
-	int1 := rand.Intn(10000)
-
-	int2 := rand.Intn(10000)
-	operator := ""
-
-	if (real_value == "true") {
-		if (int1 > int2) {
-			operator = ">"
-		} else {
-			operator = "<="
-		}
-	} else {
-		if (int1 > int2) {
-			operator = "<"
-		} else {
-			operator = ">="
-		}
-	}
-	
-	result_string := strconv.Itoa(int1) + operator + strconv.Itoa(int2)
-	result_string = "(" + result_string + ")"
-	return result_string
+	return nil
 }
 
-func obfuscateHex(real_value string) string {
-	if (*ignore_hexes_bool) {
-		return real_value
-	}
-
-	if strings.HasPrefix(real_value, "0x") {
-		real_value = real_value[2:]
+// Bools are looked up by their object, so a shadowed 'true' or 'false' is left alone
+func (o *obfuscator) obfuscateBools(pkg *Package) error {
+	err := requireTypes(pkg)
+	if err != nil {
+		return err
 	}
 
-    byteArray, err := hex.DecodeString(real_value)
-    if err != nil {
-        fmt.Println("Error decoding hex:", err)
-		return real_value
-    }
-
-	result_string := "("
-	for i := 0; i < len(byteArray); i++ {
-		if (i+1 < len(byteArray)) {
-			result_string = result_string + ","
-		}
-        byte_int := int(byteArray[i])
-		result_string = result_string + "byte(" + obfuscateIntFloat(float64(byte_int)) + ")"
-    }
-	result_string = result_string + ")"
-	
-	return result_string
-}
-
-func isInArray(target string, arr []string) bool {
-	for _, item := range arr {
-		if item == target {
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				if (pkg.Info.Uses[ident] == types.Universe.Lookup("true") || pkg.Info.Uses[ident] == types.Universe.Lookup("false")) && !o.config.NoBools {
+					pkg.recordIdent(ident, "", nil)
+					ident.Name = o.obfuscateBool(ident.Name)
+				}
+			}
 			return true
-		}
+		})
 	}
-	return false
+	return nil
 }
 
-func removeChar(input string, charToRemove byte) string {
-	result := ""
-	for i := 0; i < len(input); i++ {
-		if input[i] != charToRemove {
-			result += string(input[i])
-		}
-	}
-	return result
-}
+// Renames every identifier by the object it refers to
+func (o *obfuscator) renameObjects(pkg *Package) error {
+	err := requireTypes(pkg)
+	if err != nil {
+		return err
+	}
+
+	o.reuseNames(pkg)
+	info := pkg.Info
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.TypeSwitchStmt:
+				// The variable of a type switch is declared again in every clause,
+				// all of those objects have to end up with the same name
+				assign, ok := node.Assign.(*ast.AssignStmt)
+				if (!ok) {
+					break
+				}
+				var clause_objects []types.Object
+				for _, clause := range node.Body.List {
+					if obj := info.Implicits[clause]; obj != nil {
+						clause_objects = append(clause_objects, obj)
+					}
+				}
+				if (len(clause_objects) > 0 && o.shouldRenameObject(clause_objects[0])) {
+					new_name := o.obfuscateObjectName(clause_objects[0])
+					for _, obj := range clause_objects {
+						o.names_dictionary[obj] = new_name
+					}
+					pkg.recordIdent(assign.Lhs[0].(*ast.Ident), new_name, func() {
+						for _, obj := range clause_objects {
+							o.revertObjectName(obj)
+						}
+					})
+					pkg.changes[len(pkg.changes) - 1].fixed = o.emitted_names[new_name]
+					assign.Lhs[0].(*ast.Ident).Name = new_name
+				}
 
-func debug(str interface{}, debug_level ...int) {
-	if (debug_level != 0) {
-		if (debug_level >= global_debug_level) {
-			fmt.Printf("[?] ")
-			fmt.Println(str)
-		}
+			case *ast.Ident:
+				obj := info.Defs[node]
+				if (obj == nil) {
+					obj = info.Uses[node]
+				}
+				if (obj != nil && o.shouldRenameObject(obj)) {
+					new_name := o.obfuscateObjectName(obj)
+					// Every identifier sharing the new name is reverted together
+					pkg.recordIdent(node, new_name, func() {
+						o.revertObjectName(obj)
+					})
+					// Packages already processed refer to the object by its new name
+					pkg.changes[len(pkg.changes) - 1].fixed = o.emitted_names[new_name]
+					node.Name = new_name
+				}
+			}
+			return true
+		})
 	}
+
+	pkg.declared_objects, pkg.declared_symbols = o.declaredSymbols(pkg)
+	return nil
 }
 
-func hasImport(file *ast.File, importPath string) bool {
-	for _, imp := range file.Imports {
-		if imp.Path != nil && imp.Path.Value == fmt.Sprintf(`"%s"`, importPath) {
+// Encrypts or obfuscates every string literal except import paths
+func (o *obfuscator) obfuscateStrings(pkg *Package) error {
+	err := requireTypes(pkg)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range pkg.Files {
+		parents := parentNodes(file)
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.BasicLit:
+				// Check if it is a string literal
+				if node.Kind == token.STRING {
+					if (requiresLiteral(parents, node) || requiresConstant(pkg.Info, parents, node)) {
+						return true
+					}
+					// Strings of named types are converted back to the type after decryption
+					type_name := ""
+					if t := pkg.Info.Types[node].Type; t != nil && t != types.Typ[types.String] && t != types.Typ[types.UntypedString] {
+						name, ok := o.renamedTypeExpression(t, file, pkg.Types)
+						if (!ok) {
+							return true
+						}
+						type_name = name
+					}
+
+					// Raw and interpreted strings alike are obfuscated by the bytes they hold
+					value, err := strconv.Unquote(node.Value)
+					if err != nil {
+						return true
+					}
+
+					pkg.recordLiteral(node)
+					if (!o.isKeyShare(value) && !o.config.NoStringsEncryption) {
+						node.Value = o.encryptString(pkg, value)
+					} else {
+						node.Value = o.obfuscateString(value)
+					}
+					if (type_name != "") {
+						node.Value = type_name + "(" + node.Value + ")"
+					}
+				}
+				
+			}
 			return true
-		}
+		})
 	}
-	return false
+	return nil
 }
 
-func addImport(file *ast.File, fset *token.FileSet, import_str string) (*ast.File, *token.FileSet) {
-	// Add the imports
-	for i := 0; i < len(file.Decls); i++ {
-		d := file.Decls[i]
-
-		switch d.(type) {
-		case *ast.FuncDecl:
-			// No action
-		case *ast.GenDecl:
-			dd := d.(*ast.GenDecl)
-
-			// IMPORT Declarations
-			if dd.Tok == token.IMPORT {
-				// Add the new import
-				iSpec := &ast.ImportSpec{Path: &ast.BasicLit{Value: strconv.Quote(import_str)}}
-				dd.Specs = append(dd.Specs, iSpec)
+// Replaces ints, floats, imaginary numbers and runes, including the ones generated by previous passes. Each is replaced
+// by an expression of the type it has in its context, unless the context requires a constant
+func (o *obfuscator) obfuscateNumbers(pkg *Package) error {
+	err := pkg.Reparse()
+	if err != nil {
+		return err
+	}
+	if (o.config.NoInts) {
+		return nil
+	}
+
+	// Reparsed files are checked against the obfuscated versions of the module packages they import
+	o.checkLiteralTypes(pkg, o.verifyImporter())
+	info := pkg.Info
+	for _, file := range pkg.Files {
+		parents := parentNodes(file)
+		replacements := make(map[ast.Expr]string)
+		ast.Inspect(file, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if (!ok || (lit.Kind != token.INT && lit.Kind != token.FLOAT && lit.Kind != token.IMAG && lit.Kind != token.CHAR)) {
+				return true
 			}
-		}
-	}
 
-	// Sort the imports
-	ast.SortImports(fset, file)
+			// Literals that have to stay constant are encoded as constant expressions
+			if (requiresConstant(info, parents, lit)) {
+				if (lit.Kind == token.INT && !(o.config.NoHexes && hasHexLiterals(lit))) {
+					replacements[lit] = o.obfuscateConstantInt(constant.MakeFromLiteral(lit.Value, lit.Kind, 0))
+				} else if (lit.Kind == token.CHAR) {
+					replacements[lit] = o.obfuscateConstantRune(constant.MakeFromLiteral(lit.Value, lit.Kind, 0))
+				}
+				return true
+			}
 
-	return file, fset
-}
+			root, ok := constantRoot(info, parents, lit)
+			if _, replaced := replacements[root]; replaced || !ok || requiresConstant(info, parents, root) {
+				return true
+			}
+			if (o.config.NoHexes && hasHexLiterals(root)) {
+				return true
+			}
 
-func valueExists(dict map[string]string, value string) bool {
-    for _, v := range dict {
-        if v == value {
-            return true
-        }
-    }
-    return false
-}
+			// Literals whose type is not known are left as they are, a guessed type may not convert
+			t := literalType(info, root)
+			value := info.Types[root].Value
+			if (t == nil || value == nil) {
+				return true
+			}
 
+			byte_value, is_byte := uint64(0), false
+			if (hasHexLiterals(root) && isByteElement(info, parents, root)) {
+				byte_value, is_byte = constant.Uint64Val(constant.ToInt(value))
+			}
+			if (is_byte) {
+				replacements[root] = o.obfuscateHex(byte_value)
+			} else if replacement, ok := o.encodeConstant(value, t, file, pkg.Types); ok {
+				replacements[root] = replacement
+			}
+			return true
+		})
 
+		// Replacements are code held by literals, until the files are parsed again
+		rewriteExprs(file, func(expr ast.Expr) ast.Expr {
+			if replacement, exists := replacements[expr]; exists {
+				return &ast.BasicLit{ValuePos: expr.Pos(), Kind: token.INT, Value: replacement}
+			}
+			return expr
+		}, func(old_expr ast.Expr, new_expr ast.Expr, revert func()) {
+			pkg.recordReplacement(old_expr, new_expr, revert)
+		})
 
-func writeToOutputFile(file string, contents *ast.File, fset *token.FileSet) {
-	os.Remove(file)
-	outputFile, err := os.Create(file)
-	if err != nil {
-		fmt.Println("Error creating output file:", err)
-		os.Exit(1)
+		var expressions []string
+		for _, replacement := range replacements {
+			expressions = append(expressions, replacement)
+		}
+		for _, import_path := range encodingImports(expressions) {
+			pkg.addImport(file, import_path)
+		}
 	}
-	defer outputFile.Close()
+	pkg.Info = nil
+	pkg.Types = nil
+	return nil
+}
 
-	err = printer.Fprint(outputFile, fset, contents)
+// Adds a math operations array to every file calling math functions and calls them through it.
+// Each file gets an array of its own, so its import of math stays in use
+func (o *obfuscator) addOperationsArray(pkg *Package) error {
+	err := pkg.Reparse()
 	if err != nil {
-		fmt.Println("Error writing to output file:", err)
-		os.Exit(1)
+		return err
+	}
+	if (o.config.NoInts) {
+		return nil
 	}
-}
-
-func addFunction(file *ast.File, fset *token.FileSet, function_name string, function_content string, inputs []string, input_types []string, outputs []string, output_types []string) (*ast.File, *token.FileSet) {
-	
-	inputs_parsed := parseFieldList(inputs, input_types)
-	outputs_parsed := parseFieldList(outputs, output_types)
-
-	// The function body as a string.
-	funcBody := `
-	package main
-
-	import (
-			"fmt"
-	)
 
-	func myfunc() {
-	` + function_content + `
+	operations_str := []interface{}{
+		"math.Sqrt",
+		"math.Sin", 
+		"math.Cos", 
+		"math.Log", 
+		"math.Tan",
+		"math.Cbrt", 
 	}
-	`
+	operations_str = o.shuffle(operations_str)
 
-	// Parse the function body string into an AST.
-	body, err := parser.ParseFile(fset, "", funcBody, parser.ParseComments)
-	if err != nil {
-		fmt.Println("Error parsing function body:", err)
+	operations_array_str := "[]func(x float64)(float64){"
+	for i := 0; i < len(operations_str); i++ {
+		operations_array_str = operations_array_str + operations_str[i].(string) + ","
 	}
+	operations_array_str = operations_array_str + "}"
 
-	// Extract the body from the parsed AST.
-	var funcBodyStmts []ast.Stmt
-	for _, decl := range body.Decls {
-		if fn, ok := decl.(*ast.FuncDecl); ok {
-			if fn.Body != nil {
-				funcBodyStmts = fn.Body.List
+	// Names are picked for the files as their first operation is replaced
+	array_names := make([]string, len(pkg.Files))
+	arrayName := func(file_index int) string {
+		if (array_names[file_index] == "") {
+			name := "operations_array_obf"
+			if (file_index > 0) {
+				name = name + "_" + strconv.Itoa(file_index)
 			}
+			array_names[file_index] = o.obfuscateVariableName(name)
+			o.addSymbol(Symbol{Kind: "generated", Package: o.current_path, Name: name, NewName: array_names[file_index]})
 		}
-	}
+		return array_names[file_index]
+	}
+
+	// Operations are replaced one after another, the index expressions added for an
+	// operation only have the operations that come after it replaced
+	info := o.importInfo(pkg)
+	indexes := make([][]string, len(pkg.Files))
+	for i := 0; i < len(operations_str); i++ {
+		operation := strings.Split(operations_str[i].(string), ".")
+		for file_index, file := range pkg.Files {
+			rewriteExprs(file, func(expr ast.Expr) ast.Expr {
+				selector, ok := expr.(*ast.SelectorExpr)
+				if (!ok || !isImportRef(selector, info, operation[0]) || selector.Sel.Name != operation[1]) {
+					return expr
+				}
 
-	// Create the AST nodes representing the new function.
-	newFunc := &ast.FuncDecl{
-		Name: ast.NewIdent(function_name),
-		Type: &ast.FuncType{
-			Params:  inputs_parsed,
-			Results: outputs_parsed,
-		},
-		Body: &ast.BlockStmt{
-			List: funcBodyStmts,
-		},
+				index_str := o.obfuscateInt(uint64(i))
+				index, err := parser.ParseExpr(index_str)
+				if err != nil {
+					panic("parsing operation index: " + err.Error())
+				}
+				indexes[file_index] = append(indexes[file_index], index_str)
+				return &ast.IndexExpr{X: ast.NewIdent(arrayName(file_index)), Index: index}
+			}, func(old_expr ast.Expr, new_expr ast.Expr, revert func()) {
+				pkg.recordReplacement(old_expr, new_expr, revert)
+			})
+		}
 	}
 
-	// Add the new function declaration to the end of the file.
-	file.Decls = append(file.Decls, newFunc)
-	return file, fset
-}
-
-func addGlobalVar(file *ast.File, var_name string, var_type string, var_type_token token.Token, var_content string) *ast.File {
-	globalVar := &ast.GenDecl{
-        Tok: token.VAR,
-        Specs: []ast.Spec{
-            &ast.ValueSpec{
-                Names: []*ast.Ident{
-                    ast.NewIdent(var_name),
-                },
-                Type: ast.NewIdent(var_type), // Type of the variable
-                Values: []ast.Expr{
-                    &ast.BasicLit{
-                        Kind:  var_type_token,
-                        Value: var_content, // Initial value of the variable
-                    },
-                },
-            },
-        },
-    }
-
-    // Add the new global variable declaration to the AST
-    file.Decls = append(file.Decls, globalVar)
-
-	return file
-}
+	for file_index, file := range pkg.Files {
+		if (array_names[file_index] == "") {
+			continue
+		}
+		for _, import_path := range encodingImports(indexes[file_index]) {
+			pkg.addImport(file, import_path)
+		}
 
-func parseFieldList(fields []string, field_types []string) *ast.FieldList {
-	fields_parsed := []*ast.Field{}
-	i := 0
-	for _, name := range fields {
-		fields_parsed = append(fields_parsed, &ast.Field{
-			Names: []*ast.Ident{ast.NewIdent(name)},
-			Type:  ast.NewIdent(field_types[i]),
+		operations_array, err := parser.ParseExpr(operations_array_str)
+		if err != nil {
+			return fmt.Errorf("parsing operations array: %w", err)
+		}
+		file.Decls = append(file.Decls, &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{
+				&ast.ValueSpec{
+					Names: []*ast.Ident{ast.NewIdent(array_names[file_index])},
+					Values: []ast.Expr{operations_array},
+				},
+			},
 		})
-		i = i + 1
 	}
-	return &ast.FieldList{List: fields_parsed}
-}
-
-func addAESFunctions(file *ast.File, fset *token.FileSet) (*ast.File, *token.FileSet) {
-
-	file = addGlobalVar(file, "aes_key_obf", "string", token.STRING, "\"" + string(aes_key_obf) + "\"")
-	file = addGlobalVar(file, "iv_obf", "string", token.STRING, "\"" + string(iv_obf) + "\"")
-
-	funcBody := ""
-	funcBody = `
-	length := len(src)
-	unpadding := int(src[length-1])
-	return src[:(length - unpadding)]
-	`
-	file, fset = addFunction(file, fset, "PKCS5UnPadding", funcBody, strings.Split("src", " "), strings.Split("[]byte", " "), strings.Split("", " "), strings.Split("[]byte", " "))
-
-	funcBody = `
-	ciphertext, _ := base64.StdEncoding.DecodeString(encrypted)
-	block, _ := aes.NewCipher([]byte(aes_key_obf))
-	mode := cipher.NewCBCDecrypter(block, []byte(iv_obf))
-	mode.CryptBlocks(ciphertext, ciphertext)
-	ciphertext = PKCS5UnPadding(ciphertext)
-	return string(ciphertext)
-	`
-	file, fset = addFunction(file, fset, "aesDecrypt", funcBody, strings.Split("encrypted", " "), strings.Split("string", " "), strings.Split("", " "), strings.Split("string", " "))
-	
-
-
-	return file, fset
+	return nil
 }
 
-func aesEncrypt(plaintext string) (string) {
-	if (plaintext == "") {
-		return `""`
-	}
-
-	plaintext, _ = strconv.Unquote(`"` + plaintext + `"`)
-
-	var plainTextBlock []byte
-	length := len(plaintext)
-
-	if length%16 != 0 {
-		extendBlock := 16 - (length % 16)
-		plainTextBlock = make([]byte, length+extendBlock)
-		copy(plainTextBlock[length:], bytes.Repeat([]byte{uint8(extendBlock)}, extendBlock))
-	} else {
-		plainTextBlock = make([]byte, length)
+// Gives every import an obfuscated alias and renames its references
+func (o *obfuscator) aliasImports(pkg *Package) error {
+	if (o.config.NoImports) {
+		return nil
 	}
 
-	copy(plainTextBlock, plaintext)
-	block, err := aes.NewCipher([]byte(aes_key_obf))
-
+	// References are told apart from locals shadowing the import by their object, the files are
+	// parsed again so the added code is checked along with the rest
+	err := pkg.Reparse()
 	if err != nil {
-		debug(err)
-		return ""
+		return err
 	}
+	info := o.importInfo(pkg)
 
-	ciphertext := make([]byte, len(plainTextBlock))
-	mode := cipher.NewCBCEncrypter(block, []byte(iv_obf))
-	mode.CryptBlocks(ciphertext, plainTextBlock)
-
-	str := base64.StdEncoding.EncodeToString(ciphertext)
+	for file_index, file := range pkg.Files {
+		aliases := make(map[*types.PkgName]string)
+		for _, importSpec := range file.Imports {
+			import_path, _ := strconv.Unquote(importSpec.Path.Value)
+			// Blank and dot imports have no references, cgo requires the 'C' name
+			if ((importSpec.Name != nil && (importSpec.Name.Name == "_" || importSpec.Name.Name == ".")) || import_path == "C") {
+				continue
+			}
+			// Without an alias the import is named by the package clause, which can differ
+			// from the last element of its path, as in math/rand/v2
+			var package_name *types.PkgName
+			if (importSpec.Name != nil) {
+				package_name, _ = info.Defs[importSpec.Name].(*types.PkgName)
+			} else {
+				package_name, _ = info.Implicits[importSpec].(*types.PkgName)
+			}
+			if (package_name == nil) {
+				continue
+			}
+			import_name := package_name.Name()
+
+			aliases[package_name] = o.obfuscateFunctionName(import_name)
+			old_name := importSpec.Name
+			spec := importSpec
+			pkg.record(importSpec, importGroup(file_index, import_name), func() {
+				spec.Name = old_name
+			})
+			importSpec.Name = &ast.Ident{Name: aliases[package_name]}
+			if (aliases[package_name] != import_name) {
+				o.addSymbol(Symbol{Kind: "import", Package: o.current_path, Name: import_name, NewName: aliases[package_name]})
+			}
+		}
 
-	return str
+		ast.Inspect(file, func(n ast.Node) bool {
+			if selector, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := selector.X.(*ast.Ident); ok {
+					if package_name, ok := info.Uses[ident].(*types.PkgName); ok && aliases[package_name] != "" {
+						pkg.recordIdent(ident, importGroup(file_index, ident.Name), nil)
+						ident.Name = aliases[package_name]
+					}
+				}
+			}
+			return true
+		})
+	}
+	return nil
 }
 
-func shuffle(arr []interface{}) []interface{} {
-    // Make a copy of the slice to avoid modifying the original
-    shuffled := make([]interface{}, len(arr))
-    copy(shuffled, arr)
-
-    // Shuffle the elements
-    for i := len(shuffled) - 1; i > 0; i-- {
-        j := rand.Intn(i + 1)
-        shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-    }
-
-    return shuffled
+// Aliases of an import are reverted along with all of its references in the file
+func importGroup(file_index int, import_name string) string {
+	return "import " + strconv.Itoa(file_index) + " " + import_name
 }
 
-func trimFirstLastChars(input string) string {
-    if len(input) <= 2 {
-        return ""
-    }
-
-    trimmedString := input[1 : len(input)-1]
-
-    return trimmedString
+// Type checks the files for the objects their identifiers refer to, once code was added to them.
+// Errors are ignored, module packages resolve to their original versions, whose names and
+// import paths are still right
+func (o *obfuscator) importInfo(pkg *Package) *types.Info {
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	config := types.Config{
+		Importer: o.moduleImporter(),
+		FakeImportC: true,
+		Error: func(err error) {},
+	}
+	config.Check(o.current_path, pkg.Fset, pkg.Files, info)
+	return info
 }
 
-func containsNonNumericChars(str string) bool {
-    for _, char := range str {
-        if !unicode.IsDigit(char) {
-            return true
-        }
-    }
-    return false
+// Reports whether selector is a reference into the package imported from import_path
+func isImportRef(selector *ast.SelectorExpr, info *types.Info, import_path string) bool {
+	ident, ok := selector.X.(*ast.Ident)
+	if (!ok) {
+		return false
+	}
+	package_name, ok := info.Uses[ident].(*types.PkgName)
+	return ok && package_name.Imported().Path() == import_path
 }
 
-func hashString(s string) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte(s))
-	return h.Sum64()
-}
\ No newline at end of file
+func (o *obfuscator) printPackage(pkg *Package) ([][]byte, error) {
+	// Line directives are inserted by offset, which needs positions matching the printed files
+	if (pkg.lines != nil) {
+		err := pkg.Reparse()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var outputs [][]byte
+	for _, file := range pkg.Files {
+		content, err := printFile(file, pkg.Fset)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, content)
+	}
+	o.recordSymbols(pkg)
+	return pkg.insertLineDirectives(outputs), nil
+}
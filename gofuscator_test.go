@@ -0,0 +1,23 @@
+package gofuscator
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// The import of math/rand/v2 is named rand, not after the last element of its path
+func TestAliasImportsByPackageName(t *testing.T) {
+	source := "package main\n\nimport (\n\t\"fmt\"\n\t\"math/rand/v2\"\n)\n\nfunc main() {\n\tfmt.Println(rand.New(rand.NewPCG(1, 2)).IntN(10))\n}\n"
+	output, err := Obfuscate([]byte(source), Config{Seed: "1", Passes: []string{"typecheck", "imports"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (strings.Contains(string(output), "rand.") || strings.Contains(string(output), "fmt.")) {
+		t.Errorf("references left to the original import names:\n%s", output)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "output.go", output, 0); err != nil {
+		t.Errorf("output does not parse: %v\n%s", err, output)
+	}
+}
@@ -0,0 +1,254 @@
+package gofuscator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Journal lists every change kept by a run, in the order they were made. Replaying it
+// with Config.Replay and the same input and options makes the same changes again
+type Journal struct {
+	Seed string `json:"seed"`
+	Entries []JournalEntry `json:"entries"`
+}
+
+// JournalEntry is a single change, or a group of changes that are only made together
+// such as every identifier renamed after the same declaration
+type JournalEntry struct {
+	// Identifies the change across replays of the journal's seed
+	Key string `json:"key"`
+	Pass string `json:"pass"`
+	// Position as file:line of the first node changed, in the files as they were when the pass ran
+	Position string `json:"position"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ReadJournal reads a journal written with Config.JournalFile
+func ReadJournal(path string) (*Journal, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+
+	journal := &Journal{}
+	err = json.Unmarshal(content, journal)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	return journal, nil
+}
+
+func changeKey(pass_name string, package_path string, c *change) string {
+	return pass_name + " " + package_path + " " + c.group
+}
+
+// Reverts the changes of the pass that are not part of the replayed journal, and gives
+// the others the text they had in it
+func (o *obfuscator) replayChanges(pkg *Package, pass_name string) {
+	for i := len(pkg.changes) - 1; i >= 0; i-- {
+		c := pkg.changes[i]
+		if (c.reverted || c.import_path != "") {
+			continue
+		}
+		entry, exists := o.replay_entries[changeKey(pass_name, o.current_path, c)]
+		if (!exists) {
+			c.revert()
+			c.reverted = true
+		} else if (c.replay != nil) {
+			c.replay(entry.New)
+		}
+	}
+}
+
+// Adds the changes the pass kept to the journal, once per group
+func (o *obfuscator) journalChanges(pkg *Package, pass_name string) {
+	journaled := make(map[string]bool)
+	for _, c := range pkg.changes {
+		if (c.reverted || c.import_path != "" || journaled[c.group]) {
+			continue
+		}
+		journaled[c.group] = true
+		o.journal.Entries = append(o.journal.Entries, JournalEntry{
+			Key: changeKey(pass_name, o.current_path, c),
+			Pass: pass_name,
+			Position: c.file_name + ":" + strconv.Itoa(c.start_line),
+			Old: c.old_text,
+			New: nodeText(c.node),
+		})
+	}
+}
+
+func (o *obfuscator) writeJournal() error {
+	if (o.config.JournalFile == "") {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(o.journal, "", "\t")
+	if err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return writeFileAtomic(o.config.JournalFile, append(content, '\n'))
+}
+
+// Short text of a changed node, the part of it passes change
+func nodeText(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		return n.Value
+	case *ast.Ident:
+		return n.Name
+	case *ast.GenDecl:
+		return n.Tok.String()
+	case *ast.ImportSpec:
+		if (n.Name != nil) {
+			return n.Name.Name + " " + n.Path.Value
+		}
+		return n.Path.Value
+	case ast.Expr:
+		return types.ExprString(n)
+	}
+	return ""
+}
+
+// Obfuscates a file, a package directory or a module, returning the state of the run
+func obfuscatePath(input_path string, output_path string, config Config) (*obfuscator, error) {
+	o, err := newObfuscator(config)
+	if err != nil {
+		return nil, err
+	}
+	input_info, err := os.Stat(input_path)
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+
+	if (!input_info.IsDir()) {
+		err = o.obfuscateFiles([]string{input_path}, []string{output_path})
+	} else if _, stat_err := os.Stat(filepath.Join(input_path, "go.mod")); stat_err == nil {
+		err = o.obfuscateModule(input_path, output_path)
+	} else {
+		err = o.obfuscatePackageDir(input_path, output_path, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, o.writeOutputs()
+}
+
+// Bisect looks for the smallest set of changes whose obfuscated output still fails test. The
+// changes are the ones of config.Replay, or of a full run with config.Seed when it is nil. Every
+// subset tried is written to output_path before test is called, which reports whether the output
+// passed. Once done, output_path, the map and the journal hold the output of the returned changes
+func Bisect(input_path string, output_path string, config Config, test func() (bool, error)) ([]JournalEntry, error) {
+	log, map_file, journal_file := config.Log, config.MapFile, config.JournalFile
+	config.Log = nil
+	config.MapFile = ""
+	config.JournalFile = ""
+
+	if (config.Replay == nil) {
+		o, err := obfuscatePath(input_path, output_path, config)
+		if err != nil {
+			return nil, err
+		}
+		config.Replay = &o.journal
+	}
+	journal := *config.Replay
+
+	// Returns whether the output of the changes fails the test
+	fails := func(entries []JournalEntry) (bool, error) {
+		config.Replay = &Journal{Seed: journal.Seed, Entries: entries}
+		_, err := obfuscatePath(input_path, output_path, config)
+		if err != nil {
+			return false, err
+		}
+		passed, err := test()
+		if (log != nil && err == nil) {
+			fmt.Fprintf(log, "Bisect: %d changes, passed %t\n", len(entries), passed)
+		}
+		return !passed, err
+	}
+
+	failed, err := fails(journal.Entries)
+	if err != nil {
+		return nil, err
+	}
+	if (!failed) {
+		return nil, errors.New("the test passes with every change of the journal")
+	}
+	failed, err = fails(nil)
+	if err != nil {
+		return nil, err
+	}
+	if (failed) {
+		return nil, errors.New("the test fails without any change, the input itself fails it")
+	}
+
+	// Delta debugging, the changes are split into chunks and narrowed down to a chunk or
+	// the complement of one that still fails, until no single change can be left out
+	entries := journal.Entries
+	chunk_count := 2
+	for len(entries) >= 2 {
+		chunks := splitEntries(entries, chunk_count)
+		narrowed := false
+		for i := range chunks {
+			complement := append([]JournalEntry(nil), entries[:chunks[i][0]]...)
+			complement = append(complement, entries[chunks[i][1]:]...)
+			for j, candidate := range [][]JournalEntry{entries[chunks[i][0]:chunks[i][1]], complement} {
+				failed, err = fails(candidate)
+				if err != nil {
+					return nil, err
+				}
+				if (failed) {
+					// A failing chunk starts over with halves, a failing complement keeps the granularity
+					if (j == 0) {
+						chunk_count = 2
+					} else if (chunk_count > 2) {
+						chunk_count--
+					}
+					entries = candidate
+					narrowed = true
+					break
+				}
+			}
+			if (narrowed) {
+				break
+			}
+		}
+
+		if (!narrowed) {
+			if (chunk_count >= len(entries)) {
+				break
+			}
+			chunk_count = min(chunk_count * 2, len(entries))
+		}
+	}
+
+	// Leaves the output of the result behind
+	config.MapFile, config.JournalFile = map_file, journal_file
+	_, err = fails(entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Bounds of count chunks of about the same size
+func splitEntries(entries []JournalEntry, count int) [][2]int {
+	var chunks [][2]int
+	start := 0
+	for i := 0; i < count; i++ {
+		end := start + (len(entries) - start) / (count - i)
+		if (end > start) {
+			chunks = append(chunks, [2]int{start, end})
+		}
+		start = end
+	}
+	return chunks
+}
@@ -0,0 +1,100 @@
+package gofuscator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const bisect_source = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("alpha")
+	fmt.Println("beta")
+	fmt.Println("gamma")
+	fmt.Println("delta")
+	fmt.Println("epsilon")
+}
+`
+
+func TestSplitEntries(t *testing.T) {
+	tests := []struct {
+		length int
+		count int
+		chunks [][2]int
+	}{
+		{5, 2, [][2]int{{0, 2}, {2, 5}}},
+		{7, 3, [][2]int{{0, 2}, {2, 4}, {4, 7}}},
+		{4, 4, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 4}}},
+		// Chunks that would be empty are left out
+		{3, 5, [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+	}
+
+	for _, test := range tests {
+		chunks := splitEntries(make([]JournalEntry, test.length), test.count)
+		if (!reflect.DeepEqual(chunks, test.chunks)) {
+			t.Errorf("%d entries in %d chunks: %v, expected %v", test.length, test.count, chunks, test.chunks)
+		}
+	}
+}
+
+// A journal written by hand, keyed by the path of the input like the changes of file runs.
+// The test fails while both "beta" and "delta" are obfuscated
+func TestBisect(t *testing.T) {
+	dir := t.TempDir()
+	input_path := filepath.Join(dir, "main.go")
+	output_path := filepath.Join(dir, "output.go")
+	err := ioutil.WriteFile(input_path, []byte(bisect_source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal := &Journal{Seed: "1"}
+	for i, word := range []string{"alpha", "beta", "gamma", "delta", "epsilon"} {
+		line := input_path + ":" + strconv.Itoa(6 + i)
+		journal.Entries = append(journal.Entries, JournalEntry{Key: "strings main " + line + " \"" + word + "\"#0", Pass: "strings", Position: line})
+	}
+	// Keys that match no change are left out of every replay
+	journal.Entries = append(journal.Entries, JournalEntry{Key: "strings main " + input_path + ":99 \"missing\"#0", Pass: "strings"})
+
+	var outputs []string
+	test := func() (bool, error) {
+		content, err := ioutil.ReadFile(output_path)
+		if err != nil {
+			return false, err
+		}
+		outputs = append(outputs, string(content))
+		return strings.Contains(string(content), "\"beta\"") || strings.Contains(string(content), "\"delta\""), nil
+	}
+
+	config := Config{Seed: "1", Passes: []string{"strings"}, Replay: journal}
+	entries, err := Bisect(input_path, output_path, config, test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (!reflect.DeepEqual(entries, []JournalEntry{journal.Entries[1], journal.Entries[3]})) {
+		t.Errorf("bisected to %v, expected the changes of beta and delta", entries)
+	}
+
+	// The output of the result is left behind
+	output := outputs[len(outputs) - 1]
+	for _, word := range []string{"alpha", "gamma", "epsilon"} {
+		if (!strings.Contains(output, "\"" + word + "\"")) {
+			t.Errorf("%s is obfuscated in the final output", word)
+		}
+	}
+
+	_, err = Bisect(input_path, output_path, config, func() (bool, error) { return true, nil })
+	if (err == nil) {
+		t.Error("no error for a test that passes with every change")
+	}
+	_, err = Bisect(input_path, output_path, config, func() (bool, error) { return false, nil })
+	if (err == nil) {
+		t.Error("no error for a test that fails without any change")
+	}
+}
@@ -0,0 +1,104 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"sort"
+	"strconv"
+)
+
+// Records the original line of every function and statement, so line directives can be added
+// once the files are printed. Positions in stack traces of the obfuscated program are then the
+// original lines of files with obfuscated names
+func (o *obfuscator) addLineDirectives(pkg *Package) error {
+	if (!o.config.LineDirectives) {
+		return nil
+	}
+
+	pkg.lines = make(map[ast.Node]int)
+	pkg.line_file_names = nil
+	for i, file := range pkg.Files {
+		file_name := o.obfuscateName(o.current_package, "file " + pkg.file_names[i]) + ".go"
+		pkg.line_file_names = append(pkg.line_file_names, file_name)
+		o.addSymbol(Symbol{Kind: "file", Package: o.current_path, Name: pkg.file_names[i], NewName: file_name})
+
+		for _, node := range lineNodes(file) {
+			pkg.lines[node] = pkg.Fset.Position(node.Pos()).Line
+		}
+	}
+	return nil
+}
+
+// Functions and statements of the file in the order they appear
+func lineNodes(file *ast.File) []ast.Node {
+	var nodes []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BlockStmt:
+		case *ast.FuncDecl, ast.Stmt:
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+// Moves the recorded lines over to the nodes of the parsed copy of the files. Printing
+// keeps every function and statement, so both lists line up
+func (pkg *Package) transferLines(new_files []*ast.File) {
+	if (pkg.lines == nil) {
+		return
+	}
+
+	lines := make(map[ast.Node]int)
+	for i := range pkg.Files {
+		old_nodes := lineNodes(pkg.Files[i])
+		new_nodes := lineNodes(new_files[i])
+		if (len(old_nodes) != len(new_nodes)) {
+			pkg.o.log("Warning, line directives dropped for", pkg.file_names[i])
+			continue
+		}
+		for j, node := range old_nodes {
+			if line, exists := pkg.lines[node]; exists {
+				lines[new_nodes[j]] = line
+			}
+		}
+	}
+	pkg.lines = lines
+}
+
+// Inserts the line directives into the printed files. The files have to be freshly parsed,
+// so positions of their nodes are offsets into what they print to
+func (pkg *Package) insertLineDirectives(outputs [][]byte) [][]byte {
+	if (pkg.lines == nil) {
+		return outputs
+	}
+
+	for i, file := range pkg.Files {
+		var offsets []int
+		directives := make(map[int]string)
+		last_line := 0
+		for _, node := range lineNodes(file) {
+			line, exists := pkg.lines[node]
+			if (!exists || line == last_line) {
+				continue
+			}
+			last_line = line
+
+			offset := pkg.Fset.Position(node.Pos()).Offset
+			if _, exists := directives[offset]; !exists {
+				offsets = append(offsets, offset)
+			}
+			// The column is left out, as the line is formatted differently than the original
+			directives[offset] = "/*line " + pkg.line_file_names[i] + ":" + strconv.Itoa(line) + "*/"
+		}
+
+		// Inserted back to front, so the remaining offsets stay valid
+		sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+		output := outputs[i]
+		for _, offset := range offsets {
+			output = append(output[:offset], append([]byte(directives[offset]), output[offset:]...)...)
+		}
+		outputs[i] = output
+	}
+	return outputs
+}
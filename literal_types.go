@@ -0,0 +1,279 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// Type checks the files as they are, against the module packages importer resolves. Errors
+// are left to the verification of the pass
+func (o *obfuscator) checkLiteralTypes(pkg *Package, importer types.Importer) {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	config := types.Config{
+		Importer: importer,
+		FakeImportC: true,
+		Error: func(err error) {},
+	}
+	pkg.Types, _ = config.Check(o.current_path, pkg.Fset, pkg.Files, info)
+	pkg.Info = info
+}
+
+// Parent of every node of the file
+func parentNodes(file *ast.File) map[ast.Node]ast.Node {
+	parents := make(map[ast.Node]ast.Node)
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if (n == nil) {
+			stack = stack[:len(stack) - 1]
+			return false
+		}
+		if (len(stack) > 0) {
+			parents[n] = stack[len(stack) - 1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return parents
+}
+
+// Whether the expression has to stay a constant: it is part of a constant declaration,
+// an array length or the index key of an array or slice literal
+func requiresConstant(info *types.Info, parents map[ast.Node]ast.Node, expr ast.Expr) bool {
+	child := ast.Node(expr)
+	for parent := parents[child]; parent != nil; child, parent = parent, parents[parent] {
+		switch p := parent.(type) {
+		case *ast.GenDecl:
+			return p.Tok == token.CONST
+		case *ast.ArrayType:
+			if (p.Len == child) {
+				return true
+			}
+		case *ast.KeyValueExpr:
+			if composite, ok := parents[p].(*ast.CompositeLit); ok && p.Key == child && info.Types[composite].Type != nil {
+				switch info.Types[composite].Type.Underlying().(type) {
+				case *types.Array, *types.Slice:
+					return true
+				}
+			}
+		case *ast.FuncDecl, *ast.FuncLit:
+			return false
+		}
+	}
+	return false
+}
+
+// Whether the string has to stay a literal, as import paths and struct tags do
+func requiresLiteral(parents map[ast.Node]ast.Node, lit *ast.BasicLit) bool {
+	switch parent := parents[lit].(type) {
+	case *ast.ImportSpec:
+		return parent.Path == lit
+	case *ast.Field:
+		return parent.Tag == lit
+	}
+	return false
+}
+
+// The largest numeric constant expression the literal is an operand of. Constant arithmetic
+// is exact, so the literal can only be replaced on its own if the rest of the expression is
+// typed. ok is false when it cannot be replaced at all
+func constantRoot(info *types.Info, parents map[ast.Node]ast.Node, lit *ast.BasicLit) (root ast.Expr, ok bool) {
+	root = lit
+	for {
+		parent, is_expr := parents[root].(ast.Expr)
+		switch parent.(type) {
+		case *ast.ParenExpr, *ast.UnaryExpr, *ast.BinaryExpr:
+		default:
+			is_expr = false
+		}
+		if (!is_expr || info.Types[parent].Value == nil) {
+			break
+		}
+		if kind := info.Types[parent].Value.Kind(); kind != constant.Int && kind != constant.Float && kind != constant.Complex {
+			break
+		}
+		root = parent
+	}
+
+	// Untyped constants used along with the literal are evaluated exactly, typed ones
+	// have to fit their type at every step, just like values at runtime do
+	has_idents := false
+	ok = true
+	ast.Inspect(root, func(n ast.Node) bool {
+		if ident, is_ident := n.(*ast.Ident); is_ident {
+			switch obj := info.Uses[ident].(type) {
+			case *types.PkgName, *types.TypeName, *types.Builtin:
+			case *types.Const:
+				has_idents = true
+				if basic, is_basic := obj.Type().(*types.Basic); is_basic && basic.Info() & types.IsUntyped != 0 {
+					ok = false
+				}
+			default:
+				has_idents = true
+				ok = false
+			}
+		}
+		return true
+	})
+	if (has_idents) {
+		return lit, ok
+	}
+	return root, true
+}
+
+// Whether the expression is an element of a []byte or [n]byte composite literal
+func isByteElement(info *types.Info, parents map[ast.Node]ast.Node, expr ast.Expr) bool {
+	parent := parents[expr]
+	if key_value, ok := parent.(*ast.KeyValueExpr); ok && key_value.Value == expr {
+		parent = parents[key_value]
+	}
+	composite, ok := parent.(*ast.CompositeLit)
+	if (!ok || info.Types[composite].Type == nil) {
+		return false
+	}
+	switch composite_type := info.Types[composite].Type.Underlying().(type) {
+	case *types.Slice:
+		return types.Identical(composite_type.Elem(), types.Typ[types.Byte])
+	case *types.Array:
+		return types.Identical(composite_type.Elem(), types.Typ[types.Byte])
+	}
+	return false
+}
+
+func hasHexLiterals(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.INT && (strings.HasPrefix(lit.Value, "0x") || strings.HasPrefix(lit.Value, "0X")) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Spells the type the way the file can refer to it. ok is false if it refers
+// to a package the file does not import
+func typeExpression(t types.Type, file *ast.File, current *types.Package) (string, bool) {
+	ok := true
+	expression := types.TypeString(t, func(p *types.Package) string {
+		if (p == current) {
+			return ""
+		}
+		name, imported := importName(file, p)
+		ok = ok && imported
+		return name
+	})
+	return expression, ok
+}
+
+// Name the file refers to the package by, empty for dot imports
+func importName(file *ast.File, p *types.Package) (string, bool) {
+	for _, spec := range file.Imports {
+		import_path, _ := strconv.Unquote(spec.Path.Value)
+		if (import_path != p.Path()) {
+			continue
+		}
+		if (spec.Name == nil) {
+			return p.Name(), true
+		}
+		if (spec.Name.Name == ".") {
+			return "", true
+		}
+		if (spec.Name.Name != "_") {
+			return spec.Name.Name, true
+		}
+	}
+	return p.Name(), false
+}
+
+// Spells a named type or type parameter checked before the rename pass, under the name
+// the pass gave it. ok is false for other types
+func (o *obfuscator) renamedTypeExpression(t types.Type, file *ast.File, current *types.Package) (string, bool) {
+	var obj *types.TypeName
+	switch named := t.(type) {
+	case *types.Named:
+		if (named.TypeArgs().Len() > 0) {
+			return "", false
+		}
+		obj = named.Obj()
+	case *types.Alias:
+		obj = named.Obj()
+	case *types.TypeParam:
+		obj = named.Obj()
+	default:
+		return "", false
+	}
+
+	name := o.renamedObjectName(obj)
+	if (obj.Pkg() == nil || obj.Pkg() == current) {
+		return name, true
+	}
+	package_name, ok := importName(file, obj.Pkg())
+	if (package_name == "") {
+		return name, ok
+	}
+	return package_name + "." + name, ok
+}
+
+// Type the context converts a constant to, nil when the context gives it no type. Constants
+// that stay untyped, and the ones passed to cgo, whose types the checker cannot see, are left alone
+func literalType(info *types.Info, expr ast.Expr) types.Type {
+	t := info.Types[expr].Type
+	if (t == nil || isCgoType(t)) {
+		return nil
+	}
+	if basic, ok := t.(*types.Basic); ok && (basic.Kind() == types.Invalid || basic.Info() & types.IsUntyped != 0) {
+		return nil
+	}
+	return t
+}
+
+// Whether the type is declared by cgo, or by the package itself on top of a cgo type
+func isCgoType(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "C" {
+		return true
+	}
+	if basic, ok := t.Underlying().(*types.Basic); ok && basic.Kind() == types.Invalid {
+		return true
+	}
+	return false
+}
+
+// Encodes a numeric constant as an expression of type t. ok is false for types
+// that are not integers, floats or complex numbers, or that cannot be written in the file
+func (o *obfuscator) encodeConstant(value constant.Value, t types.Type, file *ast.File, current *types.Package) (string, bool) {
+	basic, is_basic := t.Underlying().(*types.Basic)
+	if (!is_basic) {
+		return "", false
+	}
+	type_name, ok := typeExpression(t, file, current)
+	if (!ok) {
+		return "", false
+	}
+
+	switch {
+	case basic.Info() & types.IsInteger != 0:
+		// Negative values are encoded as their two's complement, which the conversion truncates back
+		value = constant.ToInt(value)
+		if signed_value, exact := constant.Int64Val(value); exact {
+			return type_name + "(" + o.encodeUint64(uint64(signed_value)) + ")", true
+		}
+		if unsigned_value, exact := constant.Uint64Val(value); exact {
+			return type_name + "(" + o.encodeUint64(unsigned_value) + ")", true
+		}
+	case basic.Info() & types.IsFloat != 0:
+		return type_name + "(" + o.encodeFloat(value, basic.Kind() == types.Float32) + ")", true
+	case basic.Info() & types.IsComplex != 0:
+		value = constant.ToComplex(value)
+		single := basic.Kind() == types.Complex64
+		return type_name + "(complex(" + o.encodeFloat(constant.Real(value), single) + ", " + o.encodeFloat(constant.Imag(value), single) + "))", true
+	}
+	return "", false
+}
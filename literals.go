@@ -0,0 +1,174 @@
+package gofuscator
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math"
+	"math/bits"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodes an int, values above math.MaxInt64 stay uint64
+func (o *obfuscator) obfuscateInt(real_value uint64) string {
+	if (o.config.NoInts) {
+		return strconv.FormatUint(real_value, 10)
+	}
+	if (real_value > math.MaxInt64) {
+		return "(uint64(" + o.encodeUint64(real_value) + "))"
+	}
+	return "(int(" + o.encodeUint64(real_value) + "))"
+}
+
+// Integers are encoded as a chain of xor, add, sub and rotate operations over uint64, which
+// wrap around exactly. The start of the chain is passed through reflect, so the compiler
+// cannot fold the chain back into the value
+func (o *obfuscator) encodeUint64(real_value uint64) string {
+	// Every operation picked is undone on the value, so the chain runs them in reverse
+	var steps []string
+	value := real_value
+	steps_amount := o.rand.Intn(3) + 2
+	for i := 0; i < steps_amount; i++ {
+		operand := o.rand.Uint64()
+		switch o.rand.Intn(4) {
+		case 0:
+			value ^= operand
+			steps = append(steps, "^ " + strconv.FormatUint(operand, 10))
+		case 1:
+			value -= operand
+			steps = append(steps, "+ " + strconv.FormatUint(operand, 10))
+		case 2:
+			value += operand
+			steps = append(steps, "- " + strconv.FormatUint(operand, 10))
+		case 3:
+			rotation := int(operand % 63) + 1
+			value = bits.RotateLeft64(value, -rotation)
+			steps = append(steps, "rotate " + strconv.Itoa(rotation))
+		}
+	}
+
+	result_string := "reflect.ValueOf(uint64(" + strconv.FormatUint(value, 10) + ")).Uint()"
+	for i := len(steps) - 1; i >= 0; i-- {
+		if (strings.HasPrefix(steps[i], "rotate ")) {
+			rotation, _ := strconv.Atoi(strings.TrimPrefix(steps[i], "rotate "))
+			result_string = "bits.RotateLeft64(" + result_string + ", " + strconv.Itoa(rotation) + ")"
+		} else {
+			result_string = "(" + result_string + " " + steps[i] + ")"
+		}
+	}
+	return result_string
+}
+
+// Integer constants are encoded as the xor of two untyped constants, which the compiler
+// folds back exactly, so they stay usable where a constant is required
+func (o *obfuscator) obfuscateConstantInt(real_value constant.Value) string {
+	mask := constant.MakeUint64(o.rand.Uint64() >> 1)
+	return "(" + constant.BinaryOp(real_value, token.XOR, mask).ExactString() + " ^ " + mask.ExactString() + ")"
+}
+
+// Packages the encoded expressions refer to, in a fixed order
+func encodingImports(expressions []string) []string {
+	var import_paths []string
+	for _, import_path := range []string{"reflect", "math", "math/bits"} {
+		for _, expression := range expressions {
+			if (strings.Contains(expression, path.Base(import_path) + ".")) {
+				import_paths = append(import_paths, import_path)
+				break
+			}
+		}
+	}
+	return import_paths
+}
+
+// Rune constants keep a rune literal as an operand of the xor, so the expression stays an
+// untyped rune. The mask only changes the lower 16 bits, the operand is a valid code point
+// as long as it is not a surrogate
+func (o *obfuscator) obfuscateConstantRune(real_value constant.Value) string {
+	code_point, _ := constant.Int64Val(real_value)
+	for {
+		mask := o.rand.Int63n(0x10000)
+		operand := code_point ^ mask
+		if (operand < 0xD800 || operand > 0xDFFF) {
+			return fmt.Sprintf("('\\U%08x' ^ %d)", operand, mask)
+		}
+	}
+}
+
+// Floats are encoded as the bits of their IEEE 754 representation, so every value stays exact.
+// Constants of type float32 are rounded to float32 bits, not through float64
+func (o *obfuscator) encodeFloat(real_value constant.Value, single bool) string {
+	if (single) {
+		float_value, _ := constant.Float32Val(constant.ToFloat(real_value))
+		return "math.Float32frombits(uint32(" + o.encodeUint64(uint64(math.Float32bits(float_value))) + "))"
+	}
+	float_value, _ := constant.Float64Val(constant.ToFloat(real_value))
+	return "math.Float64frombits(" + o.encodeUint64(math.Float64bits(float_value)) + ")"
+}
+
+// Strings are built from their bytes, ASCII bytes as single runes and other bytes as byte
+// slices, so multibyte characters and invalid UTF-8 keep their exact bytes. Runes are converted
+// explicitly, as go vet reports conversions of integers to strings
+func (o *obfuscator) obfuscateString(real_value string) string {
+	if (o.config.NoStringsObfuscation) {
+		return strconv.Quote(real_value)
+	}
+
+	if (real_value == "") {
+		return `""`
+	}
+
+	var parts []string
+	for i := 0; i < len(real_value); {
+		if (real_value[i] < utf8.RuneSelf) {
+			parts = append(parts, "string(rune(" + strconv.Itoa(int(real_value[i])) + "))")
+			i = i + 1
+			continue
+		}
+
+		var bytes_array []string
+		for ; i < len(real_value) && real_value[i] >= utf8.RuneSelf; i++ {
+			bytes_array = append(bytes_array, strconv.Itoa(int(real_value[i])))
+		}
+		parts = append(parts, "string([]byte{" + strings.Join(bytes_array, ", ") + "})")
+	}
+
+	result_string := "(" + strings.Join(parts, "+") + ")"
+	return result_string
+}
+
+func (o *obfuscator) obfuscateBool(real_value string) string {
+	if (o.config.NoBools) {
+		return real_value
+	}
+
+	int1 := o.rand.Intn(10000)
+
+	int2 := o.rand.Intn(10000)
+	operator := ""
+
+	if (real_value == "true") {
+		if (int1 > int2) {
+			operator = ">"
+		} else {
+			operator = "<="
+		}
+	} else {
+		if (int1 > int2) {
+			operator = "<"
+		} else {
+			operator = ">="
+		}
+	}
+	
+	result_string := strconv.Itoa(int1) + operator + strconv.Itoa(int2)
+	result_string = "(" + result_string + ")"
+	return result_string
+}
+
+// Hexes in byte slices and arrays are written as bytes of their encoded value
+func (o *obfuscator) obfuscateHex(real_value uint64) string {
+	return "byte(" + o.encodeUint64(real_value) + ")"
+}
@@ -0,0 +1,85 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Evaluates the chains built by encodeUint64, reflect.ValueOf(uint64(n)).Uint() stands for n
+func evaluateUint64(t *testing.T, expr ast.Expr) uint64 {
+	switch node := expr.(type) {
+	case *ast.ParenExpr:
+		return evaluateUint64(t, node.X)
+	case *ast.BasicLit:
+		value, err := strconv.ParseUint(node.Value, 10, 64)
+		if err != nil {
+			t.Fatalf("bad operand %s: %v", node.Value, err)
+		}
+		return value
+	case *ast.BinaryExpr:
+		x := evaluateUint64(t, node.X)
+		y := evaluateUint64(t, node.Y)
+		switch node.Op {
+		case token.XOR:
+			return x ^ y
+		case token.ADD:
+			return x + y
+		case token.SUB:
+			return x - y
+		}
+	case *ast.CallExpr:
+		function := nodeText(node.Fun)
+		switch {
+		case function == "bits.RotateLeft64" && len(node.Args) == 2:
+			return bits.RotateLeft64(evaluateUint64(t, node.Args[0]), int(evaluateUint64(t, node.Args[1])))
+		case strings.HasSuffix(function, ".Uint") && len(node.Args) == 0:
+			return evaluateUint64(t, node.Fun.(*ast.SelectorExpr).X)
+		case (function == "reflect.ValueOf" || function == "uint64") && len(node.Args) == 1:
+			return evaluateUint64(t, node.Args[0])
+		}
+	}
+	t.Fatalf("unexpected expression %s", nodeText(expr))
+	return 0
+}
+
+func TestEncodeUint64(t *testing.T) {
+	values := []uint64{0, 1, 255, 1 << 53 + 1, math.MaxInt64, math.MaxInt64 + 1, math.MaxUint64 - 1, math.MaxUint64, 0xDEADBEEFCAFEBABE}
+	for _, seed := range []string{"1", "2", "3", "4", "5"} {
+		o, err := newObfuscator(Config{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range values {
+			encoded := o.encodeUint64(value)
+			expr, err := parser.ParseExpr(encoded)
+			if err != nil {
+				t.Fatalf("seed %s, %d encoded as %s does not parse: %v", seed, value, encoded, err)
+			}
+			if decoded := evaluateUint64(t, expr); decoded != value {
+				t.Errorf("seed %s, %d encoded as %s evaluates to %d", seed, value, encoded, decoded)
+			}
+			if (strings.Contains(encoded, "(uint64(" + strconv.FormatUint(value, 10) + ")).Uint()")) {
+				t.Errorf("seed %s, %d is left in the clear in %s", seed, value, encoded)
+			}
+		}
+	}
+}
+
+func TestObfuscateIntKeepsUint64(t *testing.T) {
+	o, err := newObfuscator(Config{Seed: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded := o.obfuscateInt(math.MaxUint64); !strings.HasPrefix(encoded, "(uint64(") {
+		t.Errorf("values above math.MaxInt64 have to stay uint64, got %s", encoded)
+	}
+	if encoded := o.obfuscateInt(42); !strings.HasPrefix(encoded, "(int(") {
+		t.Errorf("values up to math.MaxInt64 are ints, got %s", encoded)
+	}
+}
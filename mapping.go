@@ -0,0 +1,294 @@
+package gofuscator
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Symbol is a single renamed identifier of an obfuscation map
+type Symbol struct {
+	// One of func, method, type, field, var, const, import, file for the names of line
+	// directives, or generated for helpers added after type checking
+	Kind string `json:"kind"`
+	Package string `json:"package"`
+	// Receiver type of methods, struct type of fields and enclosing function of locals
+	Parent string `json:"parent,omitempty"`
+	Name string `json:"name"`
+	NewName string `json:"new_name"`
+	// Original position as file:line:column, empty for names of code added by the tool
+	Position string `json:"position,omitempty"`
+}
+
+// Mapping holds every name changed by a run
+type Mapping struct {
+	Symbols []Symbol `json:"symbols"`
+}
+
+// ReadMapping reads an obfuscation map written with Config.MapFile
+func ReadMapping(path string) (*Mapping, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading mapping: %w", err)
+	}
+
+	mapping := &Mapping{}
+	err = json.Unmarshal(content, mapping)
+	if err != nil {
+		return nil, fmt.Errorf("reading mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// Objects declared in the package along with the symbols describing them, in the order of
+// declaration. The positions are only meaningful while the files are the ones that were type checked
+func (o *obfuscator) declaredSymbols(pkg *Package) ([]types.Object, []Symbol) {
+	// Functions and methods owning each function scope, and struct types owning each field
+	scope_funcs := make(map[*types.Scope]string)
+	field_owners := make(map[types.Object]string)
+	for _, obj := range pkg.Info.Defs {
+		switch object := obj.(type) {
+		case *types.Func:
+			if scope := object.Scope(); scope != nil {
+				scope_funcs[scope] = funcName(object)
+			}
+		case *types.TypeName:
+			if structure, ok := object.Type().Underlying().(*types.Struct); ok && !object.IsAlias() {
+				for i := 0; i < structure.NumFields(); i++ {
+					field_owners[structure.Field(i)] = object.Name()
+				}
+			}
+		}
+	}
+
+	var objects []types.Object
+	for _, obj := range pkg.Info.Defs {
+		if (obj != nil) {
+			objects = append(objects, obj)
+		}
+	}
+	for _, obj := range pkg.Info.Implicits {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if (objects[i].Pos() != objects[j].Pos()) {
+			return objects[i].Pos() < objects[j].Pos()
+		}
+		return objects[i].Name() < objects[j].Name()
+	})
+
+	var symbols []Symbol
+	for _, obj := range objects {
+		symbol := Symbol{
+			Kind: objectKind(obj),
+			Package: obj.Pkg().Path(),
+			Name: obj.Name(),
+		}
+
+		if position := pkg.Fset.Position(obj.Pos()); position.Filename != "" {
+			symbol.Position = position.String()
+		}
+
+		switch object := obj.(type) {
+		case *types.Func:
+			if recv := object.Type().(*types.Signature).Recv(); recv != nil {
+				symbol.Parent = receiverName(recv.Type())
+			}
+		case *types.Var:
+			if (object.IsField()) {
+				symbol.Parent = field_owners[object]
+			} else if (object.Parent() != nil && object.Parent() != pkg.Types.Scope()) {
+				// Walk up to the outermost scope of the function
+				scope := object.Parent()
+				for scope.Parent() != nil && scope.Parent() != pkg.Types.Scope() && scope_funcs[scope] == "" {
+					scope = scope.Parent()
+				}
+				symbol.Parent = scope_funcs[scope]
+			}
+		}
+		symbols = append(symbols, symbol)
+	}
+	return objects, symbols
+}
+
+// Adds every object declared in the package that kept its new name
+func (o *obfuscator) recordSymbols(pkg *Package) {
+	objects, symbols := pkg.declared_objects, pkg.declared_symbols
+	for i, obj := range objects {
+		if (o.names_dictionary[obj] != "") {
+			symbols[i].NewName = o.names_dictionary[obj]
+			o.addSymbol(symbols[i])
+		}
+	}
+}
+
+// Symbols are matched across runs by what they are and where they are declared, positions
+// change with every edit. Symbols sharing a key are matched in the order of declaration
+func symbolKey(symbol Symbol) string {
+	return symbol.Kind + " " + symbol.Package + " " + symbol.Parent + " " + symbol.Name
+}
+
+// Loads the mapping of a previous run, whose names are given to the same symbols again
+func (o *obfuscator) loadPreviousMapping(path string) error {
+	mapping, err := ReadMapping(path)
+	if err != nil {
+		return err
+	}
+
+	o.previous_mapping = mapping
+	for _, symbol := range mapping.Symbols {
+		o.reserved_names[symbol.NewName] = true
+		switch symbol.Kind {
+		case "import", "generated":
+			o.previous_generated[symbol.Package + " " + symbol.Name] = symbol.NewName
+		case "file":
+			o.previous_generated[symbol.Package + " file " + symbol.Name] = strings.TrimSuffix(symbol.NewName, ".go")
+		default:
+			o.previous_names[symbolKey(symbol)] = append(o.previous_names[symbolKey(symbol)], symbol.NewName)
+		}
+	}
+	return nil
+}
+
+// Gives the objects of the package the names they had in the previous mapping. Only group roots
+// are named, the other members and embedded fields follow them
+func (o *obfuscator) reuseNames(pkg *Package) {
+	if (o.previous_mapping == nil) {
+		return
+	}
+
+	objects, symbols := o.declaredSymbols(pkg)
+	key_counts := make(map[string]int)
+	for i, obj := range objects {
+		if (!o.shouldRenameObject(obj)) {
+			continue
+		}
+		key := symbolKey(symbols[i])
+		index := key_counts[key]
+		key_counts[key]++
+
+		previous_names := o.previous_names[key]
+		if (index >= len(previous_names) || embeddedTypeName(obj) != nil || o.findObjectGroup(obj) != obj) {
+			continue
+		}
+		if _, exists := o.names_dictionary[obj]; !exists && !o.isNameTaken(previous_names[index]) {
+			o.names_dictionary[obj] = previous_names[index]
+		}
+	}
+}
+
+// Logs the symbols that were added since the previous mapping and the ones that are gone
+func (o *obfuscator) reportMappingChanges() {
+	if (o.previous_mapping == nil) {
+		return
+	}
+
+	previous_counts := make(map[string]int)
+	for _, symbol := range o.previous_mapping.Symbols {
+		previous_counts[symbolKey(symbol)]++
+	}
+	current_counts := make(map[string]int)
+	for _, symbol := range o.mapping.Symbols {
+		current_counts[symbolKey(symbol)]++
+	}
+
+	added := 0
+	seen := make(map[string]int)
+	for _, symbol := range o.mapping.Symbols {
+		key := symbolKey(symbol)
+		seen[key]++
+		if (seen[key] > previous_counts[key]) {
+			o.log("Added " + describeSymbol(symbol))
+			added++
+		}
+	}
+
+	removed := 0
+	seen = make(map[string]int)
+	for _, symbol := range o.previous_mapping.Symbols {
+		key := symbolKey(symbol)
+		seen[key]++
+		if (seen[key] > current_counts[key]) {
+			o.log("Removed " + describeSymbol(symbol))
+			removed++
+		}
+	}
+
+	o.log(fmt.Sprintf("Mapping: %d symbols added, %d removed", added, removed))
+}
+
+func describeSymbol(symbol Symbol) string {
+	name := symbol.Name
+	if (symbol.Parent != "") {
+		name = symbol.Parent + "." + name
+	}
+	description := symbol.Kind + " " + symbol.Package + " " + name + " " + symbol.NewName
+	if (symbol.Position != "") {
+		description += " (" + symbol.Position + ")"
+	}
+	return description
+}
+
+// Adds a symbol to the map once
+func (o *obfuscator) addSymbol(symbol Symbol) {
+	key := symbol.Kind + " " + symbol.Package + " " + symbol.Parent + " " + symbol.Name + " " + symbol.NewName + " " + symbol.Position
+	if (o.recorded_symbols[key]) {
+		return
+	}
+	o.recorded_symbols[key] = true
+	o.mapping.Symbols = append(o.mapping.Symbols, symbol)
+}
+
+// Reports the changes against the reused mapping and writes the obfuscation map of the run to Config.MapFile
+func (o *obfuscator) writeMapping() error {
+	o.reportMappingChanges()
+	if (o.config.MapFile == "") {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(o.mapping, "", "\t")
+	if err != nil {
+		return fmt.Errorf("writing mapping: %w", err)
+	}
+	return writeFileAtomic(o.config.MapFile, append(content, '\n'))
+}
+
+func objectKind(obj types.Object) string {
+	switch object := obj.(type) {
+	case *types.Func:
+		if (object.Type().(*types.Signature).Recv() != nil) {
+			return "method"
+		}
+		return "func"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "const"
+	case *types.Var:
+		if (object.IsField()) {
+			return "field"
+		}
+	}
+	return "var"
+}
+
+// Name of a function the way it appears in stack traces, with the receiver type for methods
+func funcName(function *types.Func) string {
+	if recv := function.Type().(*types.Signature).Recv(); recv != nil {
+		return receiverName(recv.Type()) + "." + function.Name()
+	}
+	return function.Name()
+}
+
+func receiverName(recv types.Type) string {
+	if pointer, ok := recv.(*types.Pointer); ok {
+		recv = pointer.Elem()
+	}
+	if named, ok := recv.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return recv.String()
+}
@@ -0,0 +1,142 @@
+package gofuscator
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mapping_source_v1 = `package main
+
+type Server struct {
+	port int
+}
+
+func (s *Server) describe() int {
+	return s.port
+}
+
+func helper(x int) int {
+	return x + 1
+}
+
+func main() {
+	s := &Server{port: 8080}
+	println(helper(s.describe()))
+}
+`
+
+// Declarations are added before the existing ones, which moves all of them
+const mapping_source_v2 = `package main
+
+func added() int {
+	return 2
+}
+
+type Server struct {
+	port int
+}
+
+func (s *Server) describe() int {
+	return s.port
+}
+
+func helper(x int) int {
+	return x + added()
+}
+
+func main() {
+	s := &Server{port: 8080}
+	println(helper(s.describe()))
+}
+`
+
+func symbolNames(mapping *Mapping) map[string]string {
+	names := make(map[string]string)
+	for _, symbol := range mapping.Symbols {
+		if (symbol.Kind != "generated" && symbol.Kind != "import") {
+			names[symbolKey(symbol)] = symbol.NewName
+		}
+	}
+	return names
+}
+
+func TestReuseNames(t *testing.T) {
+	dir := t.TempDir()
+	first_map := filepath.Join(dir, "first.json")
+	second_map := filepath.Join(dir, "second.json")
+	passes := []string{"typecheck", "rename"}
+
+	_, err := Obfuscate([]byte(mapping_source_v1), Config{Seed: "1", Passes: passes, MapFile: first_map})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	_, err = Obfuscate([]byte(mapping_source_v2), Config{Seed: "2", Passes: passes, MapFile: second_map, ReuseMapFile: first_map, Log: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := ReadMapping(first_map)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ReadMapping(second_map)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first_names, second_names := symbolNames(first), symbolNames(second)
+
+	for _, key := range []string{"type main  Server", "field main Server port", "method main Server describe", "func main  helper", "var main helper x", "var main main s"} {
+		if (first_names[key] == "") {
+			t.Errorf("%s is missing from the first mapping", key)
+		} else if (first_names[key] != second_names[key]) {
+			t.Errorf("%s was renamed %s, then %s", key, first_names[key], second_names[key])
+		}
+	}
+
+	added := second_names["func main  added"]
+	if (added == "") {
+		t.Fatal("the added function is missing from the second mapping")
+	}
+	for key, name := range first_names {
+		if (name == added) {
+			t.Errorf("the added function took the name of %s", key)
+		}
+	}
+	if (!strings.Contains(log.String(), "Added func main added " + added)) {
+		t.Errorf("the added function is not reported:\n%s", log.String())
+	}
+}
+
+func TestReportMappingChanges(t *testing.T) {
+	var log bytes.Buffer
+	o, err := newObfuscator(Config{Seed: "1", Log: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.previous_mapping = &Mapping{Symbols: []Symbol{
+		{Kind: "func", Package: "main", Name: "kept", NewName: "a1"},
+		{Kind: "func", Package: "main", Name: "removed", NewName: "a2", Position: "main.go:3:6"},
+		{Kind: "var", Package: "main", Parent: "main", Name: "x", NewName: "a3"},
+	}}
+	o.mapping = Mapping{Symbols: []Symbol{
+		{Kind: "func", Package: "main", Name: "kept", NewName: "a1"},
+		{Kind: "var", Package: "main", Parent: "main", Name: "x", NewName: "a3"},
+		// A second local of the same name only matches the first one
+		{Kind: "var", Package: "main", Parent: "main", Name: "x", NewName: "a4"},
+		{Kind: "field", Package: "main", Parent: "Server", Name: "port", NewName: "a5"},
+	}}
+	o.reportMappingChanges()
+
+	expected := strings.Join([]string{
+		"Added var main main.x a4",
+		"Added field main Server.port a5",
+		"Removed func main removed a2 (main.go:3:6)",
+		"Mapping: 2 symbols added, 1 removed",
+	}, "\n") + "\n"
+	if (log.String() != expected) {
+		t.Errorf("reported\n%s\nexpected\n%s", log.String(), expected)
+	}
+}
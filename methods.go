@@ -0,0 +1,379 @@
+package gofuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+)
+
+// Links the methods that must keep matching names for types to keep satisfying interfaces.
+// Concrete types and interfaces of the current package and of already processed module
+// packages are matched against each other, and groups that include a method that has to
+// satisfy an interface from outside of the obfuscated packages are pinned to their name.
+// Methods grouped with the ones of other module packages beforehand join those groups
+func (o *obfuscator) groupMethods(files []*ast.File, info *types.Info, fset *token.FileSet) error {
+	if (o.current_types_package == nil) {
+		return nil
+	}
+	o.scanExternalMethods(o.current_types_package)
+
+	named_types, interfaces := declaredTypes(files, info)
+	err := o.joinModuleGroups(named_types, interfaces, fset)
+	if err != nil {
+		return err
+	}
+
+	for _, import_path := range o.sortedModulePackages() {
+		pkg := o.module_packages[import_path]
+		if (pkg.types == nil || pkg.types == o.current_types_package) {
+			continue
+		}
+		for _, name := range pkg.types.Scope().Names() {
+			if type_name, ok := pkg.types.Scope().Lookup(name).(*types.TypeName); ok {
+				if named, ok := type_name.Type().(*types.Named); ok {
+					named_types = append(named_types, named)
+				}
+				if interface_type, ok := type_name.Type().Underlying().(*types.Interface); ok {
+					interfaces = append(interfaces, interface_type)
+				}
+			}
+		}
+	}
+	return o.linkMethods(named_types, interfaces)
+}
+
+// Named types and interface types declared in the files
+func declaredTypes(files []*ast.File, info *types.Info) ([]*types.Named, []*types.Interface) {
+	var named_types []*types.Named
+	var interfaces []*types.Interface
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.Ident:
+				if type_name, ok := info.Defs[node].(*types.TypeName); ok {
+					if named, ok := type_name.Type().(*types.Named); ok {
+						named_types = append(named_types, named)
+					}
+				}
+			case *ast.InterfaceType:
+				if interface_type, ok := info.Types[node].Type.(*types.Interface); ok {
+					interfaces = append(interfaces, interface_type)
+				}
+			}
+			return true
+		})
+	}
+	return named_types, interfaces
+}
+
+// Methods declared on the type itself, plus the explicit methods of interface types
+func declaredMethods(named *types.Named) []*types.Func {
+	var methods []*types.Func
+	for i := 0; i < named.NumMethods(); i++ {
+		methods = append(methods, named.Method(i))
+	}
+	if interface_type, ok := named.Underlying().(*types.Interface); ok {
+		for i := 0; i < interface_type.NumExplicitMethods(); i++ {
+			methods = append(methods, interface_type.ExplicitMethod(i))
+		}
+	}
+	return methods
+}
+
+// Links the methods of the types to the methods of the interfaces they satisfy
+func (o *obfuscator) linkMethods(named_types []*types.Named, interfaces []*types.Interface) error {
+	interface_method_names := make(map[string]bool)
+	for _, interface_type := range interfaces {
+		for i := 0; i < interface_type.NumMethods(); i++ {
+			interface_method_names[interface_type.Method(i).Name()] = true
+		}
+	}
+
+	generic_method_names := make(map[string]bool)
+	for _, named := range named_types {
+		for _, method := range declaredMethods(named) {
+			if (o.matchesExternalMethod(method) || (named.TypeParams().Len() > 0 && interface_method_names[method.Name()])) {
+				// Generic types cannot be checked for satisfaction without instantiation,
+				// so their methods keep any name an interface asks for
+				o.pinned_objects[o.findObjectGroup(method)] = true
+			}
+			if (named.TypeParams().Len() > 0) {
+				generic_method_names[method.Name()] = true
+			}
+		}
+
+		if (named.TypeParams().Len() > 0) {
+			continue
+		}
+
+		for _, interface_type := range interfaces {
+			var implementing types.Type
+			if (types.Implements(named, interface_type)) {
+				implementing = named
+			} else if _, is_interface := named.Underlying().(*types.Interface); !is_interface && types.Implements(types.NewPointer(named), interface_type) {
+				implementing = types.NewPointer(named)
+			} else {
+				continue
+			}
+
+			for i := 0; i < interface_type.NumMethods(); i++ {
+				interface_method := interface_type.Method(i)
+				obj, _, _ := types.LookupFieldOrMethod(implementing, false, interface_method.Pkg(), interface_method.Name())
+				if method, ok := obj.(*types.Func); ok {
+					err := o.linkObjects(interface_method, method)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// Interface literals can hold a value of any of the interfaces they are satisfied by
+	for _, interface_type := range interfaces {
+		for i := 0; i < interface_type.NumMethods(); i++ {
+			if (o.matchesExternalMethod(interface_type.Method(i)) || generic_method_names[interface_type.Method(i).Name()]) {
+				o.pinned_objects[o.findObjectGroup(interface_type.Method(i))] = true
+			}
+		}
+		for _, other_interface := range interfaces {
+			if (interface_type == other_interface || !types.Implements(interface_type, other_interface)) {
+				continue
+			}
+			for i := 0; i < other_interface.NumMethods(); i++ {
+				obj, _, _ := types.LookupFieldOrMethod(interface_type, false, other_interface.Method(i).Pkg(), other_interface.Method(i).Name())
+				if method, ok := obj.(*types.Func); ok {
+					err := o.linkObjects(other_interface.Method(i), method)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Records the exported methods of every type in the packages imported by pkg,
+// excluding the obfuscated packages themselves
+func (o *obfuscator) scanExternalMethods(pkg *types.Package) {
+	if (o.scanned_packages[pkg]) {
+		return
+	}
+	o.scanned_packages[pkg] = true
+
+	if _, exists := o.module_packages[pkg.Path()]; !exists && pkg != o.current_types_package {
+		for _, name := range pkg.Scope().Names() {
+			type_name, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+			if (!ok) {
+				continue
+			}
+			method_set := types.NewMethodSet(types.NewPointer(type_name.Type()))
+			if _, is_interface := type_name.Type().Underlying().(*types.Interface); is_interface {
+				method_set = types.NewMethodSet(type_name.Type())
+			}
+			for i := 0; i < method_set.Len(); i++ {
+				method := method_set.At(i).Obj().(*types.Func)
+				if (method.Exported()) {
+					o.external_methods[method.Name()] = append(o.external_methods[method.Name()], method.Type().(*types.Signature))
+				}
+			}
+		}
+	}
+
+	for _, imported := range pkg.Imports() {
+		o.scanExternalMethods(imported)
+	}
+}
+
+// Methods matching one declared outside of the obfuscated packages could be needed
+// to satisfy an interface there, the 'error' interface is always in scope
+func (o *obfuscator) matchesExternalMethod(method *types.Func) bool {
+	if (method.Name() == "Error" && types.Identical(method.Type(), types.Universe.Lookup("error").Type().Underlying().(*types.Interface).Method(0).Type())) {
+		return true
+	}
+	for _, signature := range o.external_methods[method.Name()] {
+		if (types.Identical(method.Type(), signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *obfuscator) findObjectGroup(obj types.Object) types.Object {
+	parent, exists := o.linked_objects[obj]
+	if (!exists || parent == obj) {
+		return obj
+	}
+	root := o.findObjectGroup(parent)
+	o.linked_objects[obj] = root
+	return root
+}
+
+// Puts two objects in the same group, which ends up with a single name. It fails if
+// both are already renamed differently, as nothing can give them matching names anymore
+func (o *obfuscator) linkObjects(first types.Object, second types.Object) error {
+	first_root := o.findObjectGroup(originObject(first))
+	second_root := o.findObjectGroup(originObject(second))
+	if (first_root == second_root) {
+		return nil
+	}
+
+	// Objects from outside of the obfuscated packages can never change their name
+	pinned := o.pinned_objects[first_root] || o.pinned_objects[second_root] || !o.isObfuscatedObject(first_root) || !o.isObfuscatedObject(second_root)
+
+	// A group that already got its name in a previous package keeps it
+	_, first_named := o.names_dictionary[first_root]
+	_, second_named := o.names_dictionary[second_root]
+	if (first_named && second_named && o.names_dictionary[first_root] != o.names_dictionary[second_root]) {
+		return fmt.Errorf("%s of %s and %s of %s were already renamed differently but have to match", first_root.Name(), first_root.Pkg().Path(), second_root.Name(), second_root.Pkg().Path())
+	}
+	if (first_named) {
+		first_root, second_root = second_root, first_root
+	}
+
+	o.linked_objects[first_root] = second_root
+	o.pinned_objects[second_root] = pinned
+	return nil
+}
+
+// Identifies a method across type checks of the module. Methods of interface literals have no
+// type name and are told apart by their position
+func methodKey(method *types.Func, fset *token.FileSet) string {
+	signature, ok := method.Type().(*types.Signature)
+	if (!ok || signature.Recv() == nil || method.Pkg() == nil) {
+		return ""
+	}
+	receiver := signature.Recv().Type()
+	if pointer, ok := receiver.(*types.Pointer); ok {
+		receiver = pointer.Elem()
+	}
+	named, ok := types.Unalias(receiver).(*types.Named)
+	if (!ok) {
+		position := fset.PositionFor(method.Pos(), false)
+		return method.Pkg().Path() + "@" + position.Filename + ":" + strconv.Itoa(position.Line) + ":" + strconv.Itoa(position.Column) + "." + method.Name()
+	}
+	if (named.Origin().Obj().Pkg() == nil) {
+		return ""
+	}
+	return named.Origin().Obj().Pkg().Path() + "." + named.Origin().Obj().Name() + "." + method.Name()
+}
+
+// Methods declared on the types, followed by the methods of interface literals
+func groupedMethods(named_types []*types.Named, interfaces []*types.Interface) []*types.Func {
+	var methods []*types.Func
+	seen := make(map[*types.Func]bool)
+	for _, named := range named_types {
+		for _, method := range declaredMethods(named) {
+			seen[method] = true
+			methods = append(methods, method)
+		}
+	}
+	for _, interface_type := range interfaces {
+		for i := 0; i < interface_type.NumExplicitMethods(); i++ {
+			if method := interface_type.ExplicitMethod(i); !seen[method] {
+				seen[method] = true
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods
+}
+
+// Groups the methods of every package of the module before any of them is renamed. Packages are
+// renamed one after another, so a method satisfying an interface of a package processed later
+// would already have a name of its own by the time the interface is seen
+func (o *obfuscator) groupModuleMethods(import_paths []string) error {
+	checked := make(map[string]*types.Package)
+	fsets := make(map[*types.Package]*token.FileSet)
+	var named_types []*types.Named
+	var interfaces []*types.Interface
+	for _, import_path := range import_paths {
+		if (o.module_packages[import_path] == nil) {
+			continue
+		}
+		fset := token.NewFileSet()
+		var files []*ast.File
+		for _, file_name := range o.module_packages[import_path].files {
+			file, err := parser.ParseFile(fset, file_name, nil, 0)
+			if err == nil {
+				files = append(files, file)
+			}
+		}
+		if (len(files) == 0) {
+			continue
+		}
+
+		info := &types.Info{
+			Defs: make(map[*ast.Ident]types.Object),
+			Types: make(map[ast.Expr]types.TypeAndValue),
+		}
+		config := types.Config{
+			// The packages of the module resolve to the ones checked for grouping
+			Importer: lookupImporter{func(path string) (*types.Package, error) {
+				return checked[path], nil
+			}},
+			FakeImportC: true,
+			Error: func(err error) {},
+		}
+		checked[import_path], _ = config.Check(import_path, fset, files, info)
+		fsets[checked[import_path]] = fset
+		o.scanExternalMethods(checked[import_path])
+
+		package_named_types, package_interfaces := declaredTypes(files, info)
+		named_types = append(named_types, package_named_types...)
+		interfaces = append(interfaces, package_interfaces...)
+	}
+
+	// The groups are built apart from the ones of the renamed objects, and kept by method key
+	linked_objects, pinned_objects := o.linked_objects, o.pinned_objects
+	o.linked_objects = make(map[types.Object]types.Object)
+	o.pinned_objects = make(map[types.Object]bool)
+	err := o.linkMethods(named_types, interfaces)
+	if err != nil {
+		return err
+	}
+
+	group_ids := make(map[types.Object]string)
+	for _, method := range groupedMethods(named_types, interfaces) {
+		key := methodKey(method, fsets[method.Pkg()])
+		if (key == "") {
+			continue
+		}
+		root := o.findObjectGroup(originObject(method))
+		if _, exists := group_ids[root]; !exists {
+			group_ids[root] = key
+		}
+		o.module_method_groups[key] = group_ids[root]
+		if (o.pinned_objects[root] || !o.isObfuscatedObject(root)) {
+			o.pinned_module_groups[group_ids[root]] = true
+		}
+	}
+	o.linked_objects, o.pinned_objects = linked_objects, pinned_objects
+	return nil
+}
+
+// Links the methods of the types and interface literals to the other members of their module group
+func (o *obfuscator) joinModuleGroups(named_types []*types.Named, interfaces []*types.Interface, fset *token.FileSet) error {
+	for _, method := range groupedMethods(named_types, interfaces) {
+		group, exists := o.module_method_groups[methodKey(method, fset)]
+		if (!exists) {
+			continue
+		}
+		if representative, exists := o.group_representatives[group]; exists {
+			err := o.linkObjects(representative, method)
+			if err != nil {
+				return err
+			}
+		} else {
+			o.group_representatives[group] = method
+		}
+		if (o.pinned_module_groups[group]) {
+			o.pinned_objects[o.findObjectGroup(originObject(method))] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package gofuscator
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type modulePackage struct {
+	name string
+	imports []string
+	// Files built on this platform, apart from tests
+	files []string
+	// Set once the package is type-checked, so the packages importing it refer to the same objects
+	types *types.Package
+	// Obfuscated version of the package, which the packages importing it are verified against
+	obfuscated_types *types.Package
+}
+
+// Shared between all runs so the standard library is only type-checked once
+var source_importer = importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+var source_importer_mutex sync.Mutex
+
+// Resolves the packages found by lookup and everything else from source. Lookup
+// returns nil and no error for the packages it does not know
+type lookupImporter struct {
+	lookup func(path string) (*types.Package, error)
+}
+
+func (l lookupImporter) Import(path string) (*types.Package, error) {
+	return l.ImportFrom(path, "", 0)
+}
+
+func (l lookupImporter) ImportFrom(path string, dir string, mode types.ImportMode) (*types.Package, error) {
+	pkg, err := l.lookup(path)
+	if (pkg != nil || err != nil) {
+		return pkg, err
+	}
+
+	source_importer_mutex.Lock()
+	defer source_importer_mutex.Unlock()
+	return source_importer.ImportFrom(path, dir, mode)
+}
+
+// Resolves packages of the module to their already checked versions
+func (o *obfuscator) moduleImporter() types.Importer {
+	return lookupImporter{func(path string) (*types.Package, error) {
+		if pkg, exists := o.module_packages[path]; exists {
+			return pkg.types, nil
+		}
+		return nil, nil
+	}}
+}
+
+// Obfuscates every package of the module rooted at input_dir into a mirrored output_dir.
+// Nested modules, vendor and testdata directories are copied verbatim. Nothing is written until
+// every package is obfuscated
+func (o *obfuscator) obfuscateModule(input_dir string, output_dir string) error {
+	module_path, err := readModulePath(filepath.Join(input_dir, "go.mod"))
+	if err != nil {
+		return err
+	}
+
+	// The output of a previous run may be inside the module
+	output_abs, _ := filepath.Abs(output_dir)
+
+	package_dirs := make(map[string]string)
+	var package_paths []string
+	err = filepath.WalkDir(input_dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if (!entry.IsDir()) {
+			return nil
+		}
+
+		rel_path, _ := filepath.Rel(input_dir, path)
+		if (path != input_dir) {
+			if path_abs, _ := filepath.Abs(path); path_abs == output_abs {
+				return filepath.SkipDir
+			}
+			// Ignored the same way by the go tool
+			if (strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			_, mod_err := os.Stat(filepath.Join(path, "go.mod"))
+			if (entry.Name() == "vendor" || entry.Name() == "testdata" || strings.HasPrefix(entry.Name(), "_") || mod_err == nil) {
+				err := o.copyDir(path, filepath.Join(output_dir, rel_path))
+				if err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+		}
+
+		import_path := module_path
+		if (rel_path != ".") {
+			import_path = module_path + "/" + filepath.ToSlash(rel_path)
+		}
+		package_dirs[import_path] = path
+		package_paths = append(package_paths, import_path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading module: %w", err)
+	}
+
+	for _, import_path := range package_paths {
+		err = o.scanModulePackage(package_dirs[import_path], import_path)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Packages are processed after the packages they import, so their objects
+	// are already known when their uses are renamed
+	processed := make(map[string]bool)
+	var order []string
+	var process func(import_path string)
+	process = func(import_path string) {
+		if (processed[import_path]) {
+			return
+		}
+		processed[import_path] = true
+
+		if pkg, exists := o.module_packages[import_path]; exists {
+			for _, dependency := range pkg.imports {
+				if _, exists := package_dirs[dependency]; exists {
+					process(dependency)
+				}
+			}
+		}
+		order = append(order, import_path)
+	}
+	for _, import_path := range package_paths {
+		process(import_path)
+	}
+
+	err = o.groupModuleMethods(order)
+	if err != nil {
+		return err
+	}
+
+	for _, import_path := range order {
+		rel_path, _ := filepath.Rel(input_dir, package_dirs[import_path])
+		err = o.obfuscatePackageDir(package_dirs[import_path], filepath.Join(output_dir, rel_path), import_path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Registers the name and imports of the package in dir
+func (o *obfuscator) scanModulePackage(dir string, import_path string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading package directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if (entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go")) {
+			continue
+		}
+		if match, _ := build.Default.MatchFile(dir, entry.Name()); !match {
+			continue
+		}
+
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, entry.Name()), nil, parser.ImportsOnly)
+		if err != nil {
+			return fmt.Errorf("parsing file: %w", err)
+		}
+
+		pkg, exists := o.module_packages[import_path]
+		if (!exists) {
+			pkg = &modulePackage{name: file.Name.Name}
+			o.module_packages[import_path] = pkg
+		}
+		if (file.Name.Name == pkg.name) {
+			pkg.files = append(pkg.files, filepath.Join(dir, entry.Name()))
+		}
+
+		for _, importSpec := range file.Imports {
+			dependency, _ := strconv.Unquote(importSpec.Path.Value)
+			pkg.imports = append(pkg.imports, dependency)
+		}
+	}
+	return nil
+}
+
+// Obfuscates every package found in input_dir and mirrors the directory into output_dir,
+// copying non-Go files verbatim. import_path is empty outside of module mode
+func (o *obfuscator) obfuscatePackageDir(input_dir string, output_dir string, import_path string) error {
+	entries, err := os.ReadDir(input_dir)
+	if err != nil {
+		return fmt.Errorf("reading input directory: %w", err)
+	}
+
+	o.staged_files = append(o.staged_files, stagedFile{path: output_dir, directory: true})
+
+	// Group the files by package clause, so that external test packages are processed on their own
+	packages := make(map[string][]string)
+	unconstrained := make(map[string]bool)
+	excluded_names := make(map[string]map[string]string)
+	excluded_members := make(map[string]map[string]string)
+	var package_names []string
+	for _, entry := range entries {
+		if (entry.IsDir()) {
+			continue
+		}
+
+		input_path := filepath.Join(input_dir, entry.Name())
+		if (!strings.HasSuffix(entry.Name(), ".go")) {
+			err = o.copyFile(input_path, filepath.Join(output_dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Files left out of the build of this platform are not type checked along with the others,
+		// two versions of the same declaration could not be renamed the same way
+		match, err := build.Default.MatchFile(input_dir, entry.Name())
+		if err != nil {
+			return fmt.Errorf("reading build constraints: %w", err)
+		}
+		if (!match) {
+			o.log("Warning, " + input_path + " is not built on " + build.Default.GOOS + "/" + build.Default.GOARCH + ", copied as is")
+			err = o.copyFile(input_path, filepath.Join(output_dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+
+			// The declarations the file uses or declares again keep their names, so it still builds
+			file, err := parser.ParseFile(token.NewFileSet(), input_path, nil, 0)
+			if err != nil {
+				continue
+			}
+			if _, exists := excluded_names[file.Name.Name]; !exists {
+				excluded_names[file.Name.Name] = make(map[string]string)
+				excluded_members[file.Name.Name] = make(map[string]string)
+			}
+			// Selectors and keys of composite literals can name methods and fields, which are
+			// matched by name as the file is not type checked
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch node := n.(type) {
+				case *ast.Ident:
+					excluded_names[file.Name.Name][node.Name] = input_path
+				case *ast.SelectorExpr:
+					excluded_members[file.Name.Name][node.Sel.Name] = input_path
+				case *ast.KeyValueExpr:
+					if key, ok := node.Key.(*ast.Ident); ok {
+						excluded_members[file.Name.Name][key.Name] = input_path
+					}
+				}
+				return true
+			})
+			continue
+		}
+
+		header, err := parser.ParseFile(token.NewFileSet(), input_path, nil, parser.PackageClauseOnly | parser.ParseComments)
+		if err != nil {
+			return fmt.Errorf("parsing file: %w", err)
+		}
+
+		if _, exists := packages[header.Name.Name]; !exists {
+			package_names = append(package_names, header.Name.Name)
+		}
+		// The first file hosts the generated helpers, so a file built everywhere the package is goes first
+		if (!hasBuildConstraints(input_path, header) && !unconstrained[header.Name.Name]) {
+			unconstrained[header.Name.Name] = true
+			packages[header.Name.Name] = append([]string{input_path}, packages[header.Name.Name]...)
+			continue
+		}
+		packages[header.Name.Name] = append(packages[header.Name.Name], input_path)
+	}
+
+	// External test packages import the package under test, so they go last
+	sort.SliceStable(package_names, func(i, j int) bool {
+		return !strings.HasSuffix(package_names[i], "_test") && strings.HasSuffix(package_names[j], "_test")
+	})
+
+	for _, package_name := range package_names {
+		var output_paths []string
+		for _, input_path := range packages[package_name] {
+			output_paths = append(output_paths, filepath.Join(output_dir, filepath.Base(input_path)))
+		}
+
+		// External test packages have their own import path
+		o.current_package = import_path
+		if (import_path != "" && strings.HasSuffix(package_name, "_test") && o.module_packages[import_path] != nil && o.module_packages[import_path].name != package_name) {
+			o.current_package = import_path + "_test"
+		}
+
+		o.excluded_names = excluded_names[package_name]
+		o.excluded_members = excluded_members[package_name]
+		err = o.obfuscateFiles(packages[package_name], output_paths)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *obfuscator) sortedModulePackages() []string {
+	var import_paths []string
+	for import_path := range o.module_packages {
+		import_paths = append(import_paths, import_path)
+	}
+	sort.Strings(import_paths)
+	return import_paths
+}
+
+// Reads the module path from the module directive of a go.mod file
+func readModulePath(go_mod string) (string, error) {
+	content, err := ioutil.ReadFile(go_mod)
+	if err != nil {
+		return "", fmt.Errorf("reading go.mod: %w", err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(strings.Split(line, "//")[0])
+		if (len(fields) == 2 && fields[0] == "module") {
+			module_path, err := strconv.Unquote(fields[1])
+			if err != nil {
+				module_path = fields[1]
+			}
+			return module_path, nil
+		}
+	}
+
+	return "", errors.New("reading go.mod: no module directive found")
+}
+
+// Stages a copy of the file as is
+func (o *obfuscator) copyFile(source string, destination string) error {
+	content, err := ioutil.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	o.staged_files = append(o.staged_files, stagedFile{path: destination, content: content})
+	return nil
+}
+
+// Stages a copy of a directory tree as is
+func (o *obfuscator) copyDir(source string, destination string) error {
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel_path, _ := filepath.Rel(source, path)
+		if (entry.IsDir()) {
+			o.staged_files = append(o.staged_files, stagedFile{path: filepath.Join(destination, rel_path), directory: true})
+			return nil
+		}
+		return o.copyFile(path, filepath.Join(destination, rel_path))
+	})
+	if err != nil {
+		return fmt.Errorf("copying directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package gofuscator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The output of a previous run inside the module is neither a package nor a nested module
+func TestObfuscateModuleIntoItself(t *testing.T) {
+	input_dir := t.TempDir()
+	output_dir := filepath.Join(input_dir, "obf")
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"main.go": "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(input_dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for run := 0; run < 2; run++ {
+		err := ObfuscateDir(input_dir, output_dir, Config{Seed: "1", Passes: []string{"typecheck", "rename"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(output_dir, "obf")); err == nil {
+		t.Error("the output of the first run was obfuscated into the output of the second")
+	}
+	if _, err := os.Stat(filepath.Join(output_dir, "main.go")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,198 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+)
+
+func (o *obfuscator) obfuscateVariableName(real_value string) string {
+	if (o.config.NoVars) {
+		return real_value
+	}
+
+	return o.obfuscateName(o.current_package, real_value)
+}
+
+func (o *obfuscator) obfuscateFunctionName(real_value string) string {
+	if (o.config.NoFunctions) {
+		return real_value
+	}
+
+	return o.obfuscateName(o.current_package, real_value)
+}
+
+// Names of generated helpers and imports, keyed by the current package and their original name
+func (o *obfuscator) obfuscateName(package_path string, real_value string) string {
+	key := real_value
+	if (package_path != "") {
+		key = package_path + "." + real_value
+	}
+
+	if _, exists := o.generated_names[key]; !exists {
+		if previous_name, exists := o.previous_generated[o.current_path + " " + real_value]; exists && !o.isNameTaken(previous_name) {
+			o.generated_names[key] = previous_name
+		} else {
+			o.generated_names[key] = o.randomName(real_value)
+		}
+	}
+	return o.generated_names[key]
+}
+
+// Names of declarations, keyed by their object so every use site is renamed
+// the same way regardless of its spelling or the file it is in
+func (o *obfuscator) obfuscateObjectName(obj types.Object) string {
+	obj = originObject(obj)
+	if _, exists := o.names_dictionary[obj]; !exists {
+		// Embedded fields are named after their type, methods and fields take the name of their group
+		if type_name := embeddedTypeName(obj); type_name != nil {
+			o.names_dictionary[obj] = o.obfuscateObjectName(type_name)
+		} else if root := o.findObjectGroup(obj); root != obj {
+			o.names_dictionary[obj] = o.obfuscateObjectName(root)
+		} else {
+			o.names_dictionary[obj] = o.randomName(obj.Name())
+		}
+	}
+	return o.names_dictionary[obj]
+}
+
+// Name the declaration has once the rename pass is done, picked up front if the pass
+// has not run yet. Declarations keep their names when the pipeline does not rename
+func (o *obfuscator) renamedObjectName(obj types.Object) string {
+	if (o.renames && o.shouldRenameObject(obj)) {
+		return o.obfuscateObjectName(obj)
+	}
+	return obj.Name()
+}
+
+// Names are unique across all packages, so the same name declared in two packages
+// is never obfuscated to the same string
+func (o *obfuscator) randomName(real_value string) string {
+	var result []rune
+	for i := 0; i < 20; i++ {
+		result = append(result, unicode_chars[o.rand.Intn(len(unicode_chars))])
+	}
+	// Exported names have to stay exported to be usable from other packages
+	if (ast.IsExported(real_value)) {
+		result[0] = unicode.ToUpper(result[0])
+	}
+	// Names of the reused mapping are kept for the symbols they belong to
+	if o.isNameTaken(string(result)) || o.reserved_names[string(result)] {
+		o.debug("again")
+		return o.randomName(real_value)
+	}
+	return string(result)
+}
+
+// Keeps the original name of obj and of its whole group from now on
+func (o *obfuscator) revertObjectName(obj types.Object) {
+	obj = originObject(obj)
+	delete(o.names_dictionary, obj)
+	o.pinned_objects[o.findObjectGroup(obj)] = true
+}
+
+func (o *obfuscator) isNameTaken(name string) bool {
+	return valueExists(o.names_dictionary, name) || valueExists(o.generated_names, name)
+}
+
+// Only declarations of the packages being obfuscated are renamed, labels and imports are left alone
+func (o *obfuscator) shouldRenameObject(obj types.Object) bool {
+	obj = originObject(obj)
+	if (obj.Name() == "_" || !o.isObfuscatedObject(obj) || !o.shouldRenameName(obj.Name())) {
+		return false
+	}
+	// Pinned after a rename that broke type checking was reverted
+	if (o.pinned_objects[o.findObjectGroup(obj)]) {
+		return false
+	}
+
+	switch object := obj.(type) {
+	case *types.Var:
+		if (object.Embedded()) {
+			type_name := embeddedTypeName(object)
+			return type_name != nil && o.shouldRenameObject(type_name)
+		}
+		if (object.IsField()) {
+			return !o.pinned_objects[o.findObjectGroup(object)] && !o.config.NoFields
+		}
+		return !o.config.NoVars
+	case *types.TypeName:
+		return !o.pinned_objects[object] && !o.config.NoTypes
+	case *types.Const:
+		return !o.config.NoVars
+	case *types.Func:
+		if (object.Type().(*types.Signature).Recv() != nil) {
+			return !o.pinned_objects[o.findObjectGroup(object)] && !o.config.NoMethods
+		}
+		if (object.Name() == "init" || (object.Name() == "main" && object.Pkg().Name() == "main")) {
+			return false
+		}
+		return !o.config.NoFunctions
+	}
+	return false
+}
+
+// Whether go test runs the function of a test file by its name, such as TestParse or Example
+func isTestFunctionName(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Example", "Fuzz"} {
+		if (!strings.HasPrefix(name, prefix)) {
+			continue
+		}
+		rest := []rune(strings.TrimPrefix(name, prefix))
+		return len(rest) == 0 || !unicode.IsLower(rest[0])
+	}
+	return false
+}
+
+// Exported names of module packages are only renamed with -exported,
+// as other packages and external users depend on them
+func (o *obfuscator) shouldRenameName(name string) bool {
+	return o.current_package == "" || o.config.Exported || !ast.IsExported(name)
+}
+
+func (o *obfuscator) isObfuscatedObject(obj types.Object) bool {
+	if (obj.Pkg() == nil) {
+		return false
+	}
+	_, exists := o.module_packages[obj.Pkg().Path()]
+	return exists || obj.Pkg() == o.current_types_package
+}
+
+// Methods and fields of instantiated generic types are separate objects from the declared ones
+func originObject(obj types.Object) types.Object {
+	switch object := obj.(type) {
+	case *types.Func:
+		return object.Origin()
+	case *types.Var:
+		return object.Origin()
+	}
+	return obj
+}
+
+// Type-checks the files of the current package. Errors are only reported, as
+// everything that could be resolved is still usable for renaming
+func (o *obfuscator) typeCheckFiles(files []*ast.File, fset *token.FileSet) *types.Info {
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Instances: make(map[*ast.Ident]types.Instance),
+	}
+
+	config := types.Config{
+		Importer: o.moduleImporter(),
+		FakeImportC: true,
+		Error: func(err error) {
+			o.log("Warning, type checking failed:", err)
+		},
+	}
+	o.current_types_package, _ = config.Check(o.current_path, fset, files, info)
+
+	if pkg, exists := o.module_packages[o.current_package]; exists {
+		pkg.types = o.current_types_package
+	}
+	return info
+}
@@ -0,0 +1,197 @@
+package gofuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"math/rand"
+)
+
+// Transformer is a single pass of the obfuscation pipeline
+type Transformer interface {
+	// Name identifies the pass in Config.Passes and in the dependencies of other passes
+	Name() string
+	// Names of the passes that have to run before this one. Missing dependencies are
+	// added to the pipeline, in the order they are listed
+	Dependencies() []string
+	// Rewrites the files of the package in place
+	Transform(pkg *Package) error
+}
+
+// Package holds the files of a single package while they go through the pipeline
+type Package struct {
+	// Import path of the package in module mode, empty otherwise
+	Path string
+	Files []*ast.File
+	Fset *token.FileSet
+
+	// Set by the "typecheck" pass, both are dropped whenever the files are parsed again
+	Info *types.Info
+	Types *types.Package
+
+	o *obfuscator
+	file_names []string
+	// Original lines of functions and statements, nil unless line directives are added
+	lines map[ast.Node]int
+	line_file_names []string
+	// Changes of the running pass, and the package checked by the last verification
+	changes []*change
+	line_changes map[string]int
+	checked_types *types.Package
+	// Declarations found by the rename pass, added to the obfuscation map once the package is done
+	declared_objects []types.Object
+	declared_symbols []Symbol
+}
+
+// Config returns the configuration of the run
+func (pkg *Package) Config() Config {
+	return pkg.o.config
+}
+
+// Rand returns the random source of the run, so passes stay reproducible with a seed
+func (pkg *Package) Rand() *rand.Rand {
+	return pkg.o.rand
+}
+
+// GeneratedName returns the name to use for a helper added by a pass, the same
+// name is returned for the same helper everywhere in the package
+func (pkg *Package) GeneratedName(name string) string {
+	new_name := pkg.o.obfuscateVariableName(name)
+	if (new_name != name) {
+		pkg.o.addSymbol(Symbol{Kind: "generated", Package: pkg.o.current_path, Name: name, NewName: new_name})
+	}
+	return new_name
+}
+
+// Reparse prints the files into memory and parses them back, so that source generated
+// into literals becomes real nodes. Type information has to be computed again afterwards
+func (pkg *Package) Reparse() error {
+	files, fset, err := reparseFiles(pkg.file_names, pkg.Files, pkg.Fset)
+	if err != nil {
+		return err
+	}
+	pkg.transferLines(files)
+	pkg.Files = files
+	pkg.Fset = fset
+	pkg.Info = nil
+	pkg.Types = nil
+	return nil
+}
+
+// Built-in passes are implemented by the obfuscator itself
+type pass struct {
+	name string
+	dependencies []string
+	transform func(o *obfuscator, pkg *Package) error
+}
+
+func (p pass) Name() string {
+	return p.name
+}
+
+func (p pass) Dependencies() []string {
+	return p.dependencies
+}
+
+func (p pass) Transform(pkg *Package) error {
+	return p.transform(pkg.o, pkg)
+}
+
+var registered_transformers = make(map[string]Transformer)
+var default_passes []string
+
+func init() {
+	builtin_passes := []pass{
+		{"lines", nil, (*obfuscator).addLineDirectives},
+		{"consts", nil, (*obfuscator).replaceConsts},
+		{"ciphers", nil, (*obfuscator).addCiphers},
+		{"typecheck", nil, (*obfuscator).typeCheck},
+		{"bools", []string{"typecheck"}, (*obfuscator).obfuscateBools},
+		{"rename", []string{"typecheck"}, (*obfuscator).renameObjects},
+		{"strings", []string{"ciphers", "typecheck"}, (*obfuscator).obfuscateStrings},
+		{"ints", nil, (*obfuscator).obfuscateNumbers},
+		{"operations", []string{"ints"}, (*obfuscator).addOperationsArray},
+		{"imports", nil, (*obfuscator).aliasImports},
+	}
+	for _, p := range builtin_passes {
+		RegisterTransformer(p)
+		default_passes = append(default_passes, p.name)
+	}
+}
+
+// RegisterTransformer makes a pass available to Config.Passes of every run. It panics
+// if a pass with the same name is already registered
+func RegisterTransformer(t Transformer) {
+	if _, exists := registered_transformers[t.Name()]; exists {
+		panic("gofuscator: pass " + t.Name() + " registered twice")
+	}
+	registered_transformers[t.Name()] = t
+}
+
+// DefaultPasses returns the names of the built-in passes in the order they run by default
+func DefaultPasses() []string {
+	return append([]string(nil), default_passes...)
+}
+
+// Resolves the passes of the run and orders every pass after its dependencies
+func (o *obfuscator) buildPipeline() ([]Transformer, error) {
+	available := make(map[string]Transformer)
+	for name, t := range registered_transformers {
+		available[name] = t
+	}
+	for _, t := range o.config.Transformers {
+		available[t.Name()] = t
+	}
+
+	names := o.config.Passes
+	if (len(names) == 0) {
+		names = DefaultPasses()
+		for _, t := range o.config.Transformers {
+			if (!isInArray(t.Name(), names)) {
+				names = append(names, t.Name())
+			}
+		}
+	}
+
+	var pipeline []Transformer
+	state := make(map[string]int) // 1 while visiting the dependencies, 2 once added
+	var visit func(name string, required_by string) error
+	visit = func(name string, required_by string) error {
+		if (isInArray(name, o.config.DisabledPasses)) {
+			if (required_by == "") {
+				return nil
+			}
+			return fmt.Errorf("pass %s is required by %s but disabled", name, required_by)
+		}
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("pass %s depends on itself", name)
+		case 2:
+			return nil
+		}
+
+		t, exists := available[name]
+		if (!exists) {
+			return fmt.Errorf("unknown pass %s", name)
+		}
+		state[name] = 1
+		for _, dependency := range t.Dependencies() {
+			err := visit(dependency, name)
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		pipeline = append(pipeline, t)
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,361 @@
+package gofuscator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func hasImport(file *ast.File, importPath string) bool {
+	for _, imp := range file.Imports {
+		if imp.Path != nil && imp.Path.Value == fmt.Sprintf(`"%s"`, importPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func addImport(file *ast.File, fset *token.FileSet, import_str string) (*ast.File, *token.FileSet) {
+	if (hasImport(file, import_str)) {
+		return file, fset
+	}
+
+	// The import of "C" keeps a declaration of its own, cgo reads the comment right above it
+	import_index := -1
+	last_import_index := -1
+	for i, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			last_import_index = i
+			if (import_index == -1 && !importsC(genDecl)) {
+				import_index = i
+			}
+		}
+	}
+
+	// Files without any other imports get an empty import declaration after the existing ones
+	if (import_index == -1) {
+		import_index = last_import_index + 1
+		position := file.Name.End()
+		if (last_import_index != -1) {
+			position = file.Decls[last_import_index].End()
+		}
+		file.Decls = append(file.Decls[:import_index], append([]ast.Decl{&ast.GenDecl{TokPos: position, Lparen: position, Tok: token.IMPORT, Rparen: position}}, file.Decls[import_index:]...)...)
+	}
+
+	// Add the import, positioned at the previous one so no comment is printed before it
+	genDecl := file.Decls[import_index].(*ast.GenDecl)
+	position := genDecl.TokPos
+	if (len(genDecl.Specs) > 0) {
+		position = genDecl.Specs[len(genDecl.Specs) - 1].Pos()
+	}
+	// A single import gets parentheses that end where it did, so the comments after it are not printed inside them
+	if (!genDecl.Lparen.IsValid()) {
+		genDecl.Lparen = position
+		genDecl.Rparen = genDecl.End()
+	}
+	iSpec := &ast.ImportSpec{Path: &ast.BasicLit{ValuePos: position, Value: strconv.Quote(import_str)}}
+	genDecl.Specs = append(genDecl.Specs, iSpec)
+	file.Imports = append(file.Imports, iSpec)
+
+	// The imports are left unsorted, sorting merges lines of the file and shifts
+	// the positions of everything after them
+	return file, fset
+}
+
+func importsC(decl *ast.GenDecl) bool {
+	for _, spec := range decl.Specs {
+		if importSpec, ok := spec.(*ast.ImportSpec); ok && importSpec.Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes every comment except for build constraints, directives such as //go:embed and
+// //export, the cgo preamble above the import of "C" and the expected output of examples in test files
+func keepDirectives(file *ast.File, test bool) {
+	preambles := make(map[*ast.CommentGroup]bool)
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT && importsC(genDecl) {
+			preambles[genDecl.Doc] = true
+			for _, spec := range genDecl.Specs {
+				preambles[spec.(*ast.ImportSpec).Doc] = true
+			}
+		}
+	}
+
+	var comments []*ast.CommentGroup
+	kept := make(map[*ast.CommentGroup]*ast.CommentGroup)
+	for _, group := range file.Comments {
+		if (preambles[group] || (test && isExampleOutput(group))) {
+			comments = append(comments, group)
+			kept[group] = group
+			continue
+		}
+		directives := &ast.CommentGroup{}
+		for _, comment := range group.List {
+			if (strings.HasPrefix(comment.Text, "//go:") || strings.HasPrefix(comment.Text, "// +build") || strings.HasPrefix(comment.Text, "//export ")) {
+				directives.List = append(directives.List, comment)
+			}
+		}
+		if (len(directives.List) > 0) {
+			comments = append(comments, directives)
+			kept[group] = directives
+		}
+	}
+	file.Comments = comments
+
+	// Directives stay attached to the declaration they are about
+	for _, decl := range file.Decls {
+		switch node := decl.(type) {
+		case *ast.FuncDecl:
+			node.Doc = kept[node.Doc]
+		case *ast.GenDecl:
+			node.Doc = kept[node.Doc]
+			for _, spec := range node.Specs {
+				switch spec := spec.(type) {
+				case *ast.ImportSpec:
+					spec.Doc = kept[spec.Doc]
+				case *ast.ValueSpec:
+					spec.Doc = kept[spec.Doc]
+				case *ast.TypeSpec:
+					spec.Doc = kept[spec.Doc]
+				}
+			}
+		}
+	}
+}
+
+// go test compares the output of an example to the comment starting with "Output:"
+func isExampleOutput(group *ast.CommentGroup) bool {
+	text := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(group.List[0].Text, "//")))
+	return strings.HasPrefix(text, "output:") || strings.HasPrefix(text, "unordered output:")
+}
+
+// Names of the declarations of the package that //go:linkname and //export directives of the file
+// refer to, the linker looks them up by name
+func directiveNames(file *ast.File, package_path string) []string {
+	var names []string
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			fields := strings.Fields(comment.Text)
+			switch {
+			case len(fields) >= 2 && fields[0] == "//export":
+				names = append(names, fields[1])
+			case len(fields) >= 2 && fields[0] == "//go:linkname":
+				names = append(names, fields[1])
+				// The target can be a declaration of the same package
+				if (len(fields) >= 3 && strings.HasPrefix(fields[2], package_path + ".")) {
+					names = append(names, strings.TrimPrefix(fields[2], package_path + "."))
+				}
+			}
+		}
+	}
+	return names
+}
+
+// Whether the file is only built for some platforms, build tags or tests, by its name or by a
+// build constraint. Files holding generated helpers have to be built everywhere the package is
+func hasBuildConstraints(file_name string, file *ast.File) bool {
+	if (strings.HasSuffix(file_name, "_test.go")) {
+		return true
+	}
+	for _, group := range file.Comments {
+		if (group.Pos() > file.Package) {
+			break
+		}
+		for _, comment := range group.List {
+			if (constraint.IsGoBuild(comment.Text) || constraint.IsPlusBuild(comment.Text)) {
+				return true
+			}
+		}
+	}
+
+	// The name is matched against a platform no file is written for, so only the files
+	// without a platform suffix match
+	context := build.Default
+	context.GOOS = "gofuscator"
+	context.GOARCH = "gofuscator"
+	context.OpenFile = func(path string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("package p")), nil
+	}
+	match, err := context.MatchFile(filepath.Dir(file_name), filepath.Base(file_name))
+	return err != nil || !match
+}
+
+func removeImport(file *ast.File, spec *ast.ImportSpec) {
+	for i, imp := range file.Imports {
+		if (imp == spec) {
+			file.Imports = append(file.Imports[:i], file.Imports[i + 1:]...)
+			break
+		}
+	}
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			for i, s := range genDecl.Specs {
+				if (s == spec) {
+					genDecl.Specs = append(genDecl.Specs[:i], genDecl.Specs[i + 1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+func printFile(file *ast.File, fset *token.FileSet) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := printer.Fprint(&buffer, fset, file)
+	if err != nil {
+		return nil, fmt.Errorf("printing file: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func parseSources(file_names []string, sources [][]byte, mode parser.Mode) ([]*ast.File, *token.FileSet, error) {
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for i := range file_names {
+		parsed_file, err := parser.ParseFile(fset, file_names[i], sources[i], mode)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing file: %w", err)
+		}
+		parsed = append(parsed, parsed_file)
+	}
+	return parsed, fset, nil
+}
+
+// Prints the files and parses them back into a fresh file set
+func reparseFiles(file_names []string, files []*ast.File, fset *token.FileSet) ([]*ast.File, *token.FileSet, error) {
+	var sources [][]byte
+	for _, file := range files {
+		source, err := printFile(file, fset)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, source)
+	}
+	return parseSources(file_names, sources, parser.ParseComments)
+}
+
+// A file of the output, directories are staged as well so that empty ones are mirrored too
+type stagedFile struct {
+	path string
+	content []byte
+	directory bool
+}
+
+// Writes to a temporary file next to path and renames it over path, so that
+// path never holds a partially written file
+func writeFileAtomic(path string, content []byte) error {
+	temp_file, err := os.CreateTemp(filepath.Dir(path), "." + filepath.Base(path) + ".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer os.Remove(temp_file.Name())
+
+	_, err = temp_file.Write(content)
+	if err == nil {
+		err = temp_file.Chmod(0644)
+	}
+	if close_err := temp_file.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		return fmt.Errorf("writing to output file: %w", err)
+	}
+
+	err = os.Rename(temp_file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("writing to output file: %w", err)
+	}
+	return nil
+}
+
+// Replaces expressions under node with the result of rewrite. Replaced expressions are
+// not walked into, so rewrite never sees the expressions it returned. replaced, if set,
+// receives every replaced expression and its replacement along with a function putting it back
+func rewriteExprs(node ast.Node, rewrite func(expr ast.Expr) ast.Expr, replaced func(old_expr ast.Expr, new_expr ast.Expr, revert func())) {
+	expr_type := reflect.TypeOf((*ast.Expr)(nil)).Elem()
+	node_type := reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+	var walk func(value reflect.Value)
+	walk = func(value reflect.Value) {
+		switch value.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if (value.IsNil()) {
+				return
+			}
+			if (value.Kind() == reflect.Interface && value.Type() == expr_type) {
+				expr := value.Interface().(ast.Expr)
+				if new_expr := rewrite(expr); new_expr != expr {
+					value.Set(reflect.ValueOf(new_expr))
+					if (replaced != nil) {
+						field := value
+						replaced(expr, new_expr, func() {
+							field.Set(reflect.ValueOf(expr))
+						})
+					}
+					return
+				}
+			}
+			if (value.Type().Implements(node_type)) {
+				walk(value.Elem())
+			}
+		case reflect.Struct:
+			for i := 0; i < value.NumField(); i++ {
+				walk(value.Field(i))
+			}
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				walk(value.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(node))
+}
+
+// Parses the declarations of source and adds them to the end of the file
+func addDeclarations(file *ast.File, fset *token.FileSet, source string) error {
+	parsed, err := parser.ParseFile(fset, "", "package p\n" + source, 0)
+	if err != nil {
+		return fmt.Errorf("parsing declarations: %w", err)
+	}
+	file.Decls = append(file.Decls, parsed.Decls...)
+	return nil
+}
+
+func addGlobalVar(file *ast.File, var_name string, var_type string, var_type_token token.Token, var_content string) *ast.File {
+	globalVar := &ast.GenDecl{
+        Tok: token.VAR,
+        Specs: []ast.Spec{
+            &ast.ValueSpec{
+                Names: []*ast.Ident{
+                    ast.NewIdent(var_name),
+                },
+                Type: ast.NewIdent(var_type), // Type of the variable
+                Values: []ast.Expr{
+                    &ast.BasicLit{
+                        Kind:  var_type_token,
+                        Value: var_content, // Initial value of the variable
+                    },
+                },
+            },
+        },
+    }
+
+    // Add the new global variable declaration to the AST
+    file.Decls = append(file.Decls, globalVar)
+
+	return file
+}
@@ -0,0 +1,61 @@
+package gofuscator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var symbolize_file_regexp = regexp.MustCompile(`([^\s]*/)?([\p{L}\p{N}_]+\.go)(:\d+)?`)
+var symbolize_name_regexp = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// Symbolize copies a goroutine dump or panic log from r to w, replacing obfuscated function,
+// method, type and package names with the original ones from mapping. Positions of files
+// obfuscated with line directives are replaced with the original files
+func Symbolize(r io.Reader, w io.Writer, mapping *Mapping) error {
+	names := make(map[string]string)
+	file_names := make(map[string]string)
+	for _, symbol := range mapping.Symbols {
+		if (symbol.Kind == "file") {
+			file_names[symbol.NewName] = symbol.Name
+			continue
+		}
+		// Names are unique to a single object or a group sharing the original name,
+		// so different originals only come from mappings of several runs
+		if name, exists := names[symbol.NewName]; exists && name != symbol.Name && !isInArray(symbol.Name, strings.Split(name, "|")) {
+			names[symbol.NewName] = name + "|" + symbol.Name
+		} else if (!exists) {
+			names[symbol.NewName] = symbol.Name
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+	writer := bufio.NewWriter(w)
+	for scanner.Scan() {
+		line := symbolize_file_regexp.ReplaceAllStringFunc(scanner.Text(), func(match string) string {
+			groups := symbolize_file_regexp.FindStringSubmatch(match)
+			if original, exists := file_names[groups[2]]; exists {
+				return original + groups[3]
+			}
+			return match
+		})
+		line = symbolize_name_regexp.ReplaceAllStringFunc(line, func(match string) string {
+			if original, exists := names[match]; exists {
+				return original
+			}
+			return match
+		})
+
+		_, err := fmt.Fprintln(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading input: %w", err)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,58 @@
+package gofuscator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSymbolize(t *testing.T) {
+	mapping := &Mapping{Symbols: []Symbol{
+		{Kind: "func", Package: "main", Name: "loadConfig", NewName: "аaаaа"},
+		{Kind: "type", Package: "main", Name: "Server", NewName: "Аaааa"},
+		{Kind: "method", Package: "main", Parent: "Server", Name: "handle", NewName: "aааaа"},
+		{Kind: "import", Package: "main", Name: "strconv", NewName: "ааaаa"},
+		{Kind: "file", Package: "main", Name: "server.go", NewName: "aаaаa.go"},
+		{Kind: "file", Package: "main", Name: "main.go", NewName: "аaааа.go"},
+		// The same new name given to two objects by runs of different packages
+		{Kind: "func", Package: "example.com/a", Name: "parse", NewName: "ааааa"},
+		{Kind: "func", Package: "example.com/b", Name: "decode", NewName: "ааааa"},
+		{Kind: "func", Package: "example.com/c", Name: "parse", NewName: "ааааa"},
+	}}
+
+	trace := strings.Join([]string{
+		"panic: strconv.Atoi: parsing \"x\": invalid syntax",
+		"",
+		"goroutine 1 [running]:",
+		"main.(*Аaааa).aааaа(0xc000012345, {0x4b2f1e, 0x1})",
+		"	/build/aаaаa.go:42 +0x1a5",
+		"main.аaаaа(...)",
+		"	/build/аaааа.go:17",
+		"example.com/a.ааааa()",
+		"	/build/a/a.go:9 +0x25",
+		"runtime.gopark(0x0?, 0x0?)",
+		"	/usr/local/go/src/runtime/proc.go:398 +0xce",
+	}, "\n")
+	expected := strings.Join([]string{
+		"panic: strconv.Atoi: parsing \"x\": invalid syntax",
+		"",
+		"goroutine 1 [running]:",
+		"main.(*Server).handle(0xc000012345, {0x4b2f1e, 0x1})",
+		"	server.go:42 +0x1a5",
+		"main.loadConfig(...)",
+		"	main.go:17",
+		"example.com/a.parse|decode()",
+		"	/build/a/a.go:9 +0x25",
+		"runtime.gopark(0x0?, 0x0?)",
+		"	/usr/local/go/src/runtime/proc.go:398 +0xce",
+	}, "\n") + "\n"
+
+	var output bytes.Buffer
+	err := Symbolize(strings.NewReader(trace), &output, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (output.String() != expected) {
+		t.Errorf("symbolized trace is\n%s\nexpected\n%s", output.String(), expected)
+	}
+}
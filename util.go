@@ -0,0 +1,51 @@
+package gofuscator
+
+import (
+	"hash/fnv"
+)
+
+func isInArray(target string, arr []string) bool {
+	for _, item := range arr {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *obfuscator) debug(str interface{}, debug_level ...int) {
+	if (len(debug_level) != 0) {
+		if (debug_level[0] >= global_debug_level) {
+			o.log("[?]", str)
+		}
+	}
+}
+
+func valueExists[K comparable](dict map[K]string, value string) bool {
+    for _, v := range dict {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+func (o *obfuscator) shuffle(arr []interface{}) []interface{} {
+    // Make a copy of the slice to avoid modifying the original
+    shuffled := make([]interface{}, len(arr))
+    copy(shuffled, arr)
+
+    // Shuffle the elements
+    for i := len(shuffled) - 1; i > 0; i-- {
+        j := o.rand.Intn(i + 1)
+        shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+    }
+
+    return shuffled
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
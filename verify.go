@@ -0,0 +1,283 @@
+package gofuscator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A change made by a pass to a single node. Changes sharing a group are reverted together,
+// such as every identifier renamed after the same object
+type change struct {
+	group string
+	file_name string
+	start_line int
+	end_line int
+	revert func()
+	reverted bool
+	// Set for changes that are not reverted, as code already written depends on them
+	fixed bool
+	// Text of the node before the change, and the node holding the new one
+	old_text string
+	node ast.Node
+	// Set for imports added for the other changes of a pass, they are removed once unused
+	// and are left out of replays and the journal
+	import_path string
+	// Sets the new text of the node when replaying a journal, the random draws of
+	// a pass change with the changes left out before it
+	replay func(text string)
+}
+
+// Records a change of the current pass to node, so it can be reverted if it breaks type checking.
+// Changes without a group are told apart by their line, their old text and their order among
+// the same text on the line, which unlike columns stay the same when earlier changes are left
+// out of a replay
+func (pkg *Package) record(node ast.Node, group string, revert func()) {
+	start := pkg.Fset.Position(node.Pos())
+	end := pkg.Fset.Position(node.End())
+	if (!node.End().IsValid()) {
+		end = start
+	}
+	old_text := nodeText(node)
+	if (group == "") {
+		line := start.Filename + ":" + strconv.Itoa(start.Line) + " " + old_text
+		group = line + "#" + strconv.Itoa(pkg.line_changes[line])
+		pkg.line_changes[line]++
+	}
+	pkg.changes = append(pkg.changes, &change{group: group, file_name: start.Filename, start_line: start.Line, end_line: end.Line, revert: revert, old_text: old_text, node: node})
+}
+
+// Records old_expr being replaced by new_expr
+func (pkg *Package) recordReplacement(old_expr ast.Expr, new_expr ast.Expr, revert func()) {
+	pkg.record(old_expr, "", revert)
+	c := pkg.changes[len(pkg.changes) - 1]
+	c.node = new_expr
+	if lit, ok := new_expr.(*ast.BasicLit); ok {
+		c.replay = func(text string) {
+			lit.Value = text
+		}
+	}
+}
+
+// Adds the import to the file, it is removed again if the changes using it are all reverted
+func (pkg *Package) addImport(file *ast.File, import_path string) {
+	if (hasImport(file, import_path)) {
+		return
+	}
+	addImport(file, pkg.Fset, import_path)
+	spec := file.Imports[len(file.Imports) - 1]
+	pkg.changes = append(pkg.changes, &change{
+		group: "import " + pkg.Fset.Position(file.Package).Filename + " " + import_path,
+		revert: func() {
+			removeImport(file, spec)
+		},
+		node: spec,
+		import_path: import_path,
+	})
+}
+
+// Records a change of the literal, to be called before its value is replaced
+func (pkg *Package) recordLiteral(lit *ast.BasicLit) {
+	old_value := lit.Value
+	pkg.record(lit, "", func() {
+		lit.Value = old_value
+	})
+	pkg.changes[len(pkg.changes) - 1].replay = func(text string) {
+		lit.Value = text
+	}
+}
+
+// Records a change of the identifier, to be called before it is renamed
+func (pkg *Package) recordIdent(ident *ast.Ident, group string, reverted func()) {
+	old_name := ident.Name
+	pkg.record(ident, group, func() {
+		ident.Name = old_name
+		if (reverted != nil) {
+			reverted()
+		}
+	})
+}
+
+func (c *change) covers(position token.Position) bool {
+	return position.Line > 0 && c.file_name == position.Filename && c.start_line <= position.Line && position.Line <= c.end_line
+}
+
+type checkError struct {
+	position token.Position
+	msg string
+	// Declaration of the object the error is reported at, the change breaking
+	// a use is often the one made to the declaration
+	declaration token.Position
+}
+
+// Resolves module packages to the obfuscated versions checked by their last verification
+func (o *obfuscator) verifyImporter() types.Importer {
+	return lookupImporter{func(path string) (*types.Package, error) {
+		if pkg, exists := o.module_packages[path]; exists {
+			if (pkg.obfuscated_types == nil) {
+				return nil, errors.New("package " + path + " is not verified")
+			}
+			return pkg.obfuscated_types, nil
+		}
+		return nil, nil
+	}}
+}
+
+// Type checks the package as it would be printed. Source generated into literals only becomes
+// code once printed, so the files are printed and parsed again, with line directives pointing
+// back to the positions of the current file set. Errors are keyed by file and line
+func (o *obfuscator) checkPackage(pkg *Package) (map[string]checkError, *types.Package) {
+	// The parser cleans the file names of line directives and joins relative ones to the directory
+	// of the parsed file, files are parsed under their base name and the names are mapped back
+	file_names := make(map[string]string)
+	for _, file_name := range pkg.file_names {
+		file_names[filepath.Clean(file_name)] = file_name
+	}
+
+	mapped := func(position token.Position) token.Position {
+		if file_name, exists := file_names[position.Filename]; exists {
+			position.Filename = file_name
+		}
+		return position
+	}
+
+	check_errors := make(map[string]checkError)
+	add_error := func(position token.Position, msg string) {
+		position = mapped(position)
+		key := position.Filename + ":" + strconv.Itoa(position.Line)
+		if _, exists := check_errors[key]; !exists {
+			check_errors[key] = checkError{position: position, msg: msg}
+		}
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for i, file := range pkg.Files {
+		var buffer bytes.Buffer
+		err := (&printer.Config{Mode: printer.SourcePos, Tabwidth: 8}).Fprint(&buffer, pkg.Fset, file)
+		if err != nil {
+			add_error(token.Position{Filename: pkg.file_names[i]}, err.Error())
+			continue
+		}
+
+		file, err = parser.ParseFile(fset, filepath.Base(pkg.file_names[i]), buffer.Bytes(), 0)
+		if error_list, ok := err.(scanner.ErrorList); ok {
+			for _, parse_error := range error_list {
+				add_error(parse_error.Pos, parse_error.Msg)
+			}
+			continue
+		} else if err != nil {
+			add_error(token.Position{Filename: pkg.file_names[i]}, err.Error())
+			continue
+		}
+		files = append(files, file)
+	}
+
+	var type_errors []types.Error
+	config := types.Config{
+		Importer: o.verifyImporter(),
+		FakeImportC: true,
+		Error: func(err error) {
+			if type_error, ok := err.(types.Error); ok {
+				type_errors = append(type_errors, type_error)
+			}
+		},
+	}
+	info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+	checked, _ := config.Check(o.current_path, fset, files, info)
+
+	used_objects := make(map[token.Pos]types.Object)
+	for ident, obj := range info.Uses {
+		used_objects[ident.Pos()] = obj
+	}
+	// Some errors are reported before the use is recorded, package level objects are looked up by name
+	if (checked != nil) {
+		for _, file := range files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && used_objects[ident.Pos()] == nil {
+					if obj := checked.Scope().Lookup(ident.Name); obj != nil && obj.Pos() != ident.Pos() {
+						used_objects[ident.Pos()] = obj
+					}
+				}
+				return true
+			})
+		}
+	}
+	for _, type_error := range type_errors {
+		position := mapped(fset.Position(type_error.Pos))
+		add_error(position, type_error.Msg)
+		if obj := used_objects[type_error.Pos]; obj != nil && obj.Pkg() == checked {
+			key := position.Filename + ":" + strconv.Itoa(position.Line)
+			check_error := check_errors[key]
+			check_error.declaration = mapped(fset.Position(obj.Pos()))
+			check_errors[key] = check_error
+		}
+	}
+	return check_errors, checked
+}
+
+// Type checks the package after a pass and reverts the changes of the pass on the lines of
+// errors that were not there before it. Lines move whenever the files are parsed again, so
+// errors are compared to the baseline by file and message. Returns the errors the package is left with,
+// or an error if the pass broke type checking in a way no change can be reverted for
+func (o *obfuscator) verifyPass(pkg *Package, pass_name string, baseline map[string]checkError) (map[string]checkError, error) {
+	baseline_messages := make(map[string]bool)
+	for _, check_error := range baseline {
+		baseline_messages[check_error.position.Filename + " " + check_error.msg] = true
+	}
+
+	for {
+		check_errors, checked := o.checkPackage(pkg)
+		pkg.checked_types = checked
+
+		var new_errors []string
+		for key, check_error := range check_errors {
+			if (!baseline_messages[check_error.position.Filename + " " + check_error.msg]) {
+				new_errors = append(new_errors, key)
+			}
+		}
+		sort.Strings(new_errors)
+		if (len(new_errors) == 0) {
+			return check_errors, nil
+		}
+
+		// Every change on the line of an error or of the declaration it is about is reverted along with its group,
+		// added imports have no position and are matched by the error about them being unused
+		reverted_groups := make(map[string]bool)
+		for _, key := range new_errors {
+			reverted := false
+			for _, c := range pkg.changes {
+				unused_import := c.import_path != "" && c.file_name == "" && strings.HasPrefix(check_errors[key].msg, strconv.Quote(c.import_path) + " imported and not used")
+				if (!c.reverted && !c.fixed && !reverted_groups[c.group] && (unused_import || c.covers(check_errors[key].position) || c.covers(check_errors[key].declaration))) {
+					reverted_groups[c.group] = true
+					reverted = true
+				}
+			}
+			if (reverted) {
+				o.log(fmt.Sprintf("Warning, reverted %s changes at %s, %s", pass_name, key, check_errors[key].msg))
+			}
+		}
+
+		if (len(reverted_groups) == 0) {
+			return nil, fmt.Errorf("pass %s broke type checking at %s, %s", pass_name, new_errors[0], check_errors[new_errors[0]].msg)
+		}
+
+		// Reverted back to front, so changes made on top of each other are undone in order
+		for i := len(pkg.changes) - 1; i >= 0; i-- {
+			if (reverted_groups[pkg.changes[i].group] && !pkg.changes[i].reverted) {
+				pkg.changes[i].revert()
+				pkg.changes[i].reverted = true
+			}
+		}
+	}
+}
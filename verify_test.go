@@ -0,0 +1,59 @@
+package gofuscator
+
+import (
+	"go/ast"
+	"testing"
+)
+
+// Files given with a directory are printed with relative line directives, the errors have to
+// come back under the same file name for the changes on their lines to be reverted
+func TestVerifyPassRevertsInDirectory(t *testing.T) {
+	o, err := newObfuscator(Config{Seed: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.current_path = "main"
+
+	file_names := []string{"p/main.go", "p/util.go"}
+	sources := [][]byte{
+		[]byte("package main\n\nfunc main() {\n\tprintln(double(2))\n}\n"),
+		[]byte("package main\n\nfunc double(x int) int {\n\treturn x * 2\n}\n"),
+	}
+	files, fset, err := parseSources(file_names, sources, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &Package{Files: files, Fset: fset, o: o, file_names: file_names, line_changes: make(map[string]int)}
+
+	baseline, _ := o.checkPackage(pkg)
+	if (len(baseline) != 0) {
+		t.Fatalf("unexpected errors before the change: %v", baseline)
+	}
+
+	// Renames the use of double but not its declaration
+	var use *ast.Ident
+	ast.Inspect(files[0], func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == "double" {
+			use = ident
+		}
+		return true
+	})
+	pkg.recordIdent(use, "renamed", nil)
+	use.Name = "renamed"
+
+	check_errors, _ := o.checkPackage(pkg)
+	if _, exists := check_errors["p/main.go:4"]; !exists || len(check_errors) != 1 {
+		t.Fatalf("expected a single error at p/main.go:4, got %v", check_errors)
+	}
+
+	check_errors, err = o.verifyPass(pkg, "rename", baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(check_errors) != 0) {
+		t.Errorf("errors left after the revert: %v", check_errors)
+	}
+	if (use.Name != "double") {
+		t.Errorf("the rename was not reverted, the call is to %s", use.Name)
+	}
+}